@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/johnknott/repocontext/internal/config"
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/pkg/repocontext"
+)
+
+// runCheck implements `repocontext check`: it reports whether cached docs
+// were generated from the repository's current commit, without calling the
+// LLM. It returns the process exit code.
+func runCheck(args []string) int {
+	cfg, err := config.New()
+	if err != nil {
+		fatal(configError(err))
+	}
+
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	quiet := fs.Bool("quiet", false, "suppress progress output")
+	fs.StringVar(&cfg.RepoDir, "repo-dir", cfg.RepoDir, "cache directory for clones (default ~/.repocontext, or $REPOCONTEXT_HOME)")
+	fs.StringVar(&cfg.DocsDir, "docs-dir", cfg.DocsDir, "base directory docs were written to")
+	fs.BoolVar(&cfg.Incremental, "incremental", cfg.Incremental, "check docs generated with --incremental, which are cached separately")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: repocontext check [flags] user/repo[@tag|#branch][:subpath]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *quiet {
+		logger.SetLevel(logger.LevelQuiet)
+	}
+
+	result, err := repocontext.Check(context.Background(), repocontext.Options{Repo: fs.Arg(0), Config: cfg})
+	if err != nil {
+		fatal(err)
+	}
+
+	if result.Metadata == nil {
+		fmt.Fprintf(os.Stderr, "No documentation found for %s in %s\n", fs.Arg(0), result.DocsPath)
+		return exitStale
+	}
+
+	if !result.Current {
+		fmt.Fprintf(os.Stderr, "Documentation for %s is stale: generated from %s, current commit is %s\n",
+			fs.Arg(0), result.Metadata.CommitHash, result.CommitHash)
+		return exitStale
+	}
+
+	logger.Printf("Documentation for %s is up to date (commit %s)\n", fs.Arg(0), result.CommitHash)
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/config"
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/httpclient"
+	"github.com/johnknott/repocontext/internal/llm"
+)
+
+// doctorTimeout bounds each network check
+const doctorTimeout = 10 * time.Second
+
+// doctorCheck is one line of the doctor report. Checks that aren't critical
+// only warn when they fail.
+type doctorCheck struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) (string, error)
+}
+
+// runDoctor implements `repocontext doctor`: it checks the configuration,
+// API key, network access, cache directory and git, printing a report. It
+// never generates docs, and returns exitUnhealthy if a critical check fails.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: repocontext doctor")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, cfgErr := config.New()
+	if cfgErr == nil {
+		cfgErr = cfg.Validate()
+	}
+	var httpClient *http.Client
+	if cfgErr == nil {
+		httpClient, cfgErr = httpclient.New(cfg.Proxy)
+	}
+
+	checks := []doctorCheck{
+		{"configuration", true, func(ctx context.Context) (string, error) {
+			if cfgErr != nil {
+				return "", cfgErr
+			}
+			return fmt.Sprintf("model %s", cfg.Model), nil
+		}},
+		{"API key present", true, func(ctx context.Context) (string, error) {
+			if cfgErr != nil {
+				return "", errors.New("skipped: configuration failed")
+			}
+			if err := cfg.Backend().Validate(); err != nil {
+				return "", err
+			}
+			return cfg.Provider, nil
+		}},
+		{"API key valid", true, func(ctx context.Context) (string, error) {
+			if cfgErr != nil || cfg.Backend().Validate() != nil {
+				return "", errors.New("skipped: no usable API key")
+			}
+			if cfg.Provider != llm.ProviderAnthropic || cfg.BaseURL != "" {
+				return "not checked: only the key for api.anthropic.com can be verified", nil
+			}
+			if err := llm.CheckAPIKey(ctx, httpClient, cfg.AnthropicKey); err != nil {
+				var apiErr *llm.APIError
+				if errors.As(err, &apiErr) {
+					return "", fmt.Errorf("%v (%s)", err, apiErr.Hint())
+				}
+				return "", err
+			}
+			return "api.anthropic.com accepted the key", nil
+		}},
+		{"github.com reachable", true, func(ctx context.Context) (string, error) {
+			if cfgErr != nil {
+				return "", errors.New("skipped: configuration failed")
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://github.com", nil)
+			if err != nil {
+				return "", err
+			}
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				return "", err
+			}
+			resp.Body.Close()
+			return resp.Status, nil
+		}},
+		{"cache directory writable", true, func(ctx context.Context) (string, error) {
+			dir := ""
+			if cfg != nil {
+				dir = cfg.RepoDir
+			}
+			if dir == "" {
+				var err error
+				if dir, err = git.DefaultBaseDir(); err != nil {
+					return "", err
+				}
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return "", err
+			}
+			f, err := os.CreateTemp(dir, ".doctor-")
+			if err != nil {
+				return "", err
+			}
+			f.Close()
+			os.Remove(f.Name())
+			return dir, nil
+		}},
+		{"git installed", false, func(ctx context.Context) (string, error) {
+			path, err := exec.LookPath("git")
+			if err != nil {
+				return "", errors.New("not found on PATH (optional: clones use a built-in git implementation)")
+			}
+			return path, nil
+		}},
+	}
+
+	failed := false
+	for _, check := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		detail, err := check.run(ctx)
+		cancel()
+
+		switch {
+		case err == nil:
+			fmt.Printf("[PASS] %s", check.name)
+			if detail != "" {
+				fmt.Printf(": %s", detail)
+			}
+			fmt.Println()
+		case check.critical:
+			failed = true
+			fmt.Printf("[FAIL] %s: %v\n", check.name, err)
+		default:
+			fmt.Printf("[WARN] %s: %v\n", check.name, err)
+		}
+	}
+
+	if failed {
+		return exitUnhealthy
+	}
+	return 0
+}
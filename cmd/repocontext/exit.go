@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/johnknott/repocontext/internal/llm"
+	"github.com/johnknott/repocontext/pkg/repocontext"
+)
+
+// Exit codes, so scripts and CI can tell failures apart:
+//
+//	0      success
+//	1      usage error, `check` found missing or stale docs, or a `doctor`
+//	       check failed
+//	2      invalid configuration, flags or arguments
+//	3      clone, fetch or other git/network failure
+//	4      LLM failure not covered by a code below
+//	5      filesystem error reading or writing docs
+//	6      broken links in the docs with --strict-links
+//	10-14  classified LLM API errors (see llmExitCodes)
+//	130    interrupted by SIGINT or SIGTERM; finished sections are kept
+const (
+	exitUsage      = 1
+	exitStale      = 1
+	exitUnhealthy  = 1
+	exitConfig     = 2
+	exitGit        = 3
+	exitLLM        = 4
+	exitFilesystem = 5
+	exitLinks      = 6
+
+	exitInterrupted = 130
+)
+
+// Exit codes for classified LLM API failures
+var llmExitCodes = map[llm.ErrorKind]int{
+	llm.ErrorInvalidKey:    10,
+	llm.ErrorQuotaExceeded: 11,
+	llm.ErrorRateLimited:   12,
+	llm.ErrorModelNotFound: 13,
+	llm.ErrorOverloaded:    14,
+}
+
+// stageExitCodes maps pipeline stages to exit codes
+var stageExitCodes = map[repocontext.Stage]int{
+	repocontext.StageConfig:     exitConfig,
+	repocontext.StageGit:        exitGit,
+	repocontext.StageLLM:        exitLLM,
+	repocontext.StageFilesystem: exitFilesystem,
+	repocontext.StageLinks:      exitLinks,
+}
+
+// configError tags a CLI-level configuration error, e.g. conflicting flags
+func configError(err error) error {
+	return &repocontext.Error{Stage: repocontext.StageConfig, Err: err}
+}
+
+// fsError tags a CLI-level filesystem error, e.g. writing output files
+func fsError(err error) error {
+	return &repocontext.Error{Stage: repocontext.StageFilesystem, Err: err}
+}
+
+// exitCode maps an error to the process exit code
+func exitCode(err error) int {
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		if code, ok := llmExitCodes[apiErr.Kind]; ok {
+			return code
+		}
+		return exitLLM
+	}
+
+	var stageErr *repocontext.Error
+	if errors.As(err, &stageErr) {
+		if code, ok := stageExitCodes[stageErr.Stage]; ok {
+			return code
+		}
+	}
+	return exitUsage
+}
+
+// interrupted reports a run cancelled by a signal and exits. Sections
+// finished before it are already on disk, so a rerun reuses them.
+func interrupted() {
+	fmt.Fprintln(os.Stderr, "\ninterrupted, partial progress saved")
+	os.Exit(exitInterrupted)
+}
+
+// fatal prints err and exits with its code. Recognised API errors also get
+// an actionable hint.
+func fatal(err error) {
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.Kind != llm.ErrorUnknown {
+		fmt.Fprintf(os.Stderr, "Error: %s\n(%v)\n", apiErr.Hint(), err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -2,117 +2,456 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"maps"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/johnknott/repocontext/internal/config"
-	"github.com/johnknott/repocontext/internal/docs"
-	"github.com/johnknott/repocontext/internal/git"
-	"github.com/johnknott/repocontext/internal/llm"
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/pkg/repocontext"
 )
 
+// jsonResult is the output written to stdout in --json mode
+type jsonResult struct {
+	Repository    string    `json:"repository"`
+	CommitHash    string    `json:"commit_hash"`
+	DocsPath      string    `json:"docs_path"`
+	ModelUsed     string    `json:"model_used"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	WordCount     int       `json:"word_count"`
+	ReadingTime   int       `json:"reading_minutes"`
+	Tags          []string  `json:"tags,omitempty"`
+	Warnings      []string  `json:"warnings"`
+	MissingPaths  []string  `json:"missing_paths,omitempty"`
+	Documentation string    `json:"documentation"`
+
+	Sections  []repocontext.Section         `json:"sections"`
+	Selection []selectedFile                `json:"selection,omitempty"`
+	Citations []repocontext.CitationProblem `json:"unverified_citations,omitempty"`
+	Manifest  *repocontext.Manifest         `json:"manifest,omitempty"`
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: repocontext user/repo[@tag]")
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		}
 	}
 
-	cfg := config.New()
-	if cfg.AnthropicKey == "" {
-		log.Fatal("ANTHROPIC_API_KEY environment variable must be set")
+	cfg, err := config.New()
+	if err != nil {
+		fatal(configError(err))
 	}
 
-	// Initialize LLM client
-	fmt.Println("Initializing Claude client...")
-	client, err := llm.NewClient(cfg.AnthropicKey)
-	if err != nil {
-		log.Fatal(err)
+	flag.IntVar(&cfg.MaxContextSize, "max-size", cfg.MaxContextSize, "maximum total size in bytes of files to include")
+	flag.IntVar(&cfg.MaxRepoSize, "max-repo-size", cfg.MaxRepoSize, "refuse repositories larger than this many megabytes (0 disables the limit)")
+	flag.StringVar(&cfg.Model, "model", cfg.Model, "model to generate documentation with")
+	models := flag.String("models", strings.Join(cfg.Models, ","), "comma-separated models to try in order when one is overloaded or unavailable (overrides --model)")
+	flag.IntVar(&cfg.ContextWindow, "model-context-window", cfg.ContextWindow, "model context limit in tokens, for proxies and custom deployments (default: the model's known limit)")
+	flag.StringVar(&cfg.Provider, "provider", cfg.Provider, "LLM provider: anthropic, azure for Azure OpenAI (key in AZURE_OPENAI_API_KEY), or bedrock for AWS Bedrock (standard AWS credentials and region; --model takes a Bedrock model ID)")
+	flag.StringVar(&cfg.BaseURL, "base-url", cfg.BaseURL, "API endpoint: the Azure OpenAI resource endpoint, or a gateway in front of Anthropic")
+	branch := flag.String("branch", "", "document this branch instead of the default branch (same as user/repo#branch)")
+	commit := flag.String("commit", "", "document this exact commit, given as a full 40-character SHA (same as user/repo@<sha>)")
+	flag.IntVar(&cfg.History, "history", cfg.History, "clone the last N commits instead of a shallow clone, for the changelog section")
+	forceClone := flag.Bool("force-clone", false, "delete the cached clone and clone the repository afresh")
+	subpath := flag.String("path", "", "only fetch and document this subdirectory (needs git installed; otherwise the whole repository is fetched)")
+	flag.StringVar(&cfg.RepoDir, "repo-dir", cfg.RepoDir, "cache directory for clones and docs (default ~/.repocontext, or $REPOCONTEXT_HOME)")
+	flag.StringVar(&cfg.DocsDir, "docs-dir", cfg.DocsDir, "write docs under <dir>/<user>/<repo>/<commit> instead of next to the clone")
+	flag.IntVar(&cfg.MaxConcurrency, "max-concurrency", cfg.MaxConcurrency, "maximum API requests in flight at once")
+	flag.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "proxy URL for clones and API calls (default: HTTPS_PROXY/HTTP_PROXY)")
+	sections := flag.String("sections", strings.Join(cfg.Sections, ","), "comma-separated sections to generate (overview,getting_started,usage; changelog is optional and needs --history)")
+	fullSections := flag.String("full-sections", strings.Join(cfg.FullSections, ","), "comma-separated sections to assemble into full.md, from those generated (default: all of them)")
+	flag.IntVar(&cfg.SoftTokenCap, "soft-token-cap", cfg.SoftTokenCap, "warn when a streamed completion passes this many tokens (0 = off)")
+	flag.IntVar(&cfg.HardTokenCap, "hard-token-cap", cfg.HardTokenCap, "cancel a streamed completion that passes this many tokens, failing the section (0 = off)")
+	sectionTokens := flag.String("section-tokens", "", "comma-separated completion token limits for individual sections, e.g. overview=6000,usage=3000")
+	include := flag.String("include", strings.Join(cfg.Include, ","), "comma-separated globs of files to include; !glob re-includes files skipped by default, e.g. !vendor/mylib/**")
+	exclude := flag.String("exclude", strings.Join(cfg.Exclude, ","), "comma-separated globs of files to exclude")
+	flag.BoolVar(&cfg.IncludeTests, "include-tests", cfg.IncludeTests, "include test files (excluded by default)")
+	flag.BoolVar(&cfg.BinaryNames, "include-binary-names", cfg.BinaryNames, "list binary files by name and size (never contents) in the overview's file tree")
+	flag.BoolVar(&cfg.Authors, "authors", cfg.Authors, "name the recent authors of the key files in the overview (needs --history)")
+	flag.BoolVar(&cfg.NoEmails, "no-emails", cfg.NoEmails, "give author names without email addresses with --authors")
+	flag.BoolVar(&cfg.Strict, "strict", cfg.Strict, "fail if any file can't be read or classified, instead of warning and leaving it out")
+	flag.IntVar(&cfg.TruncateSize, "truncate-size", cfg.TruncateSize, "cut text files larger than this many bytes to their first and last lines, instead of leaving them out for not fitting --max-size (0 = off)")
+	flag.BoolVar(&cfg.StripComments, "strip-comments", cfg.StripComments, "remove comments and license headers from source files before prompting, so more code fits in --max-size")
+	languages := flag.String("languages", strings.Join(cfg.Languages, ","), "comma-separated languages to document, e.g. go,python (docs are always included)")
+	flag.Float64Var(&cfg.SelectionFloor, "selection-floor", cfg.SelectionFloor, "warn when selected files use less than this fraction of --max-size")
+	flag.BoolVar(&cfg.CheckLinks, "check-links", cfg.CheckLinks, "check links in full.md after generation: relative links against the repository's files, external links for a 2xx response")
+	flag.BoolVar(&cfg.SkipExternalLinks, "skip-external-links", cfg.SkipExternalLinks, "with --check-links, only check links to repository files")
+	flag.BoolVar(&cfg.StrictLinks, "strict-links", cfg.StrictLinks, "fail the run if full.md has broken links (implies --check-links)")
+	flag.BoolVar(&cfg.CiteSource, "cite-source", cfg.CiteSource, "have the usage section quote source excerpts attributed as // from path:line, and warn about any that don't match the repository")
+	flag.StringVar(&cfg.Language, "lang", cfg.Language, "write the documentation in this language, e.g. es or Spanish; code is left untranslated (default English)")
+	noDedup := flag.Bool("no-dedup", !cfg.Dedup, "skip the cleanup pass, leaving full.md as the sections concatenated (saves a model call)")
+	flag.BoolVar(&cfg.Tags, "tags", cfg.Tags, "extract topic tags into the metadata and docs (one extra API call; --tags=false to skip)")
+	flag.BoolVar(&cfg.TopUp, "top-up", cfg.TopUp, "fill a selection below --selection-floor with heuristically ranked files")
+	selectorName := flag.String("selector", "llm", "how to choose files when over --max-size: llm or heuristic (no API call)")
+	filesFrom := flag.String("files-from", "", "use exactly the repository-relative paths listed in this file (one per line) instead of selecting files")
+	record := flag.String("record", "", "save every prompt and completion to this directory")
+	replay := flag.String("replay", "", "answer from completions saved with --record instead of calling the API")
+	docGlobs := flag.String("doc-globs", strings.Join(cfg.DocGlobs, ","), "comma-separated globs or extensions of extra documentation files, e.g. 'website/content/**,.adoc'; they're prioritized in selection")
+	forceText := flag.String("force-text", strings.Join(cfg.ForceText, ","), "comma-separated globs of files to treat as text even if they look binary")
+	flag.BoolVar(&cfg.Incremental, "incremental", cfg.Incremental, "write sections from per-file summaries cached by content hash, so only changed files are re-summarized")
+	slocStrict := flag.Bool("sloc-strict", false, "skip blank and comment-only lines when counting lines of code")
+	quiet := flag.Bool("quiet", false, "suppress progress output")
+	verbose := flag.Bool("verbose", false, "show detailed progress output")
+	jsonOutput := flag.Bool("json", false, "print the result as JSON (implies --quiet)")
+	stream := flag.Bool("stream", false, "print each section to stdout as it is generated")
+	frontmatter := flag.Bool("frontmatter", false, "prepend YAML frontmatter (title, weight, repo, commit, date) to each doc file")
+	summaryOnly := flag.Bool("summary-only", false, "print a one-paragraph summary of the project (also saved as summary.md) instead of the full docs")
+	selectOnly := flag.Bool("select-only", false, "print the selected files (one per line, or JSON with --json) and exit without generating docs")
+	stdoutOnly := flag.Bool("stdout-only", false, "generate in a temporary directory and print only the documentation to stdout, keeping nothing on disk")
+	promptDump := flag.String("prompt-dump", "", "write the exact prompts to this directory (- for stdout) and exit without calling the API; files are selected heuristically")
+	refreshSelection := flag.Bool("refresh-selection", false, "select files afresh instead of reusing the cached selection, report how it changed, and regenerate only if it did (with --select-only, just report)")
+	manifest := flag.Bool("manifest", false, "also write manifest.json beside the docs: entry points, top-level directories, languages and dependencies as JSON for other tools")
+	noRepoConfig := flag.Bool("no-repo-config", false, "ignore a .repocontext.yaml committed at the root of the documented repository")
+	postProcess := flag.String("post-process", "", "shell command to pipe full.md through after the cleanup pass; its output becomes the final full.md, and a non-zero exit fails the run")
+	compare := flag.String("compare", "", "generate the overview (or the --sections given) with two comma-separated models side by side under docs/compare/, for evaluation")
+	since := flag.String("since", "", "reuse cached docs unless the latest commit is newer than this duration (72h, 7d) or date")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: repocontext [flags] user/repo[@tag|#branch][:subpath]")
+		fmt.Fprintln(os.Stderr, "       repocontext [flags] https://host/path/archive.tar.gz|.tgz|.zip")
+		fmt.Fprintln(os.Stderr, "       repocontext check [flags] user/repo[@tag|#branch][:subpath]")
+		fmt.Fprintln(os.Stderr, "       repocontext serve [flags] user/repo[@tag|#branch][:subpath]")
+		fmt.Fprintln(os.Stderr, "       repocontext doctor")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nExit codes: 0 success, 1 usage, 2 config, 3 git/network, 4 LLM, 5 filesystem, 6 broken links,")
+		fmt.Fprintln(os.Stderr, "10 invalid API key, 11 quota exceeded, 12 rate limited, 13 unknown model, 14 API overloaded")
 	}
+	flag.Parse()
 
-	// Parse and clone repository
-	repoPath := os.Args[1]
-	fmt.Printf("Parsing repository path: %s\n", repoPath)
-	repo, err := git.ParseRepoPath(repoPath)
-	if err != nil {
-		log.Fatal(err)
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
 	}
 
-	fmt.Printf("Cloning/updating repository %s/%s...\n", repo.User, repo.Repo)
-	repoPath, err = repo.Clone()
-	if err != nil {
-		log.Fatal(err)
+	cfg.Dedup = !*noDedup
+	cfg.Sections = config.SplitList(*sections)
+	cfg.FullSections = config.SplitList(*fullSections)
+	if *sectionTokens != "" {
+		limits, err := config.ParseSectionTokens(*sectionTokens)
+		if err != nil {
+			fatal(configError(err))
+		}
+		if cfg.SectionTokens == nil {
+			cfg.SectionTokens = make(map[string]int)
+		}
+		maps.Copy(cfg.SectionTokens, limits)
+	}
+	cfg.Include = config.SplitList(*include)
+	cfg.Exclude = config.SplitList(*exclude)
+	cfg.Languages = config.SplitList(*languages)
+	cfg.ForceText = config.SplitList(*forceText)
+	cfg.DocGlobs = config.SplitList(*docGlobs)
+	// An explicit --model replaces a configured chain unless --models is given too
+	if isFlagSet("model") && !isFlagSet("models") {
+		cfg.Models = nil
+	} else if cfg.Models = config.SplitList(*models); len(cfg.Models) > 0 {
+		cfg.Model = cfg.Models[0]
 	}
 
-	fmt.Printf("Repository available at: %s\n", repoPath)
+	if *stream && *jsonOutput {
+		fatal(configError(errors.New("--stream cannot be combined with --json")))
+	}
+	if *summaryOnly && *selectOnly {
+		fatal(configError(errors.New("--summary-only cannot be combined with --select-only")))
+	}
+	if *promptDump != "" && (*selectOnly || *jsonOutput || *stream) {
+		fatal(configError(errors.New("--prompt-dump cannot be combined with --select-only, --json or --stream")))
+	}
+	if *stdoutOnly && (*jsonOutput || *stream) {
+		fatal(configError(errors.New("--stdout-only cannot be combined with --json or --stream")))
+	}
+	if *compare != "" && (*jsonOutput || *stdoutOnly) {
+		fatal(configError(errors.New("--compare cannot be combined with --json or --stdout-only")))
+	}
+	if *record != "" && *replay != "" {
+		fatal(configError(errors.New("--record cannot be combined with --replay")))
+	}
 
-	// Get commit hash
-	commitHash, err := repo.GetCurrentCommitHash()
-	if err != nil {
-		log.Fatal(err)
+	opts := repocontext.Options{
+		Repo:        flag.Arg(0),
+		Config:      cfg,
+		Branch:      *branch,
+		Commit:      *commit,
+		Subpath:     *subpath,
+		ForceClone:  *forceClone,
+		Ephemeral:   *stdoutOnly,
+		SelectOnly:  *selectOnly,
+		SummaryOnly: *summaryOnly,
+		PromptsOnly: *promptDump != "",
+		Record:      *record,
+		Replay:      *replay,
+		SLOCStrict:  *slocStrict,
+		Frontmatter: *frontmatter,
+		Compare:     config.SplitList(*compare),
+		PostProcess: *postProcess,
+
+		RefreshSelection: *refreshSelection,
+		NoRepoConfig:     *noRepoConfig,
+		Manifest:         *manifest,
+	}
+	if *since != "" {
+		if opts.Since, err = parseSince(*since, time.Now()); err != nil {
+			fatal(configError(err))
+		}
+	}
+	if *filesFrom != "" {
+		if *selectorName != "llm" {
+			fatal(configError(errors.New("--files-from cannot be combined with --selector")))
+		}
+		if opts.Files, err = repocontext.ReadFileList(*filesFrom); err != nil {
+			fatal(configError(err))
+		}
+	}
+	switch *selectorName {
+	case "llm":
+	case "heuristic":
+		opts.Selector = repocontext.HeuristicSelector{}
+	default:
+		fatal(configError(fmt.Errorf("unknown selector %q (supported: llm, heuristic)", *selectorName)))
+	}
+	if *stream {
+		opts.Stream = os.Stdout
 	}
-	fmt.Printf("Current commit: %s\n", commitHash)
 
-	// Get file listing
-	fmt.Println("\nScanning repository files...")
-	files, err := repo.GetFiles()
-	if err != nil {
-		log.Fatal(err)
+	switch {
+	case *quiet || *jsonOutput:
+		logger.SetLevel(logger.LevelQuiet)
+	case *verbose:
+		logger.SetLevel(logger.LevelVerbose)
+	}
+	// Keep stdout clean for redirecting the documentation to a file
+	if *stdoutOnly {
+		logger.SetOutput(os.Stderr)
 	}
-	fmt.Printf("Found %d files\n", len(files))
 
-	// Select files to analyze
-	fmt.Printf("\nSelecting files to include (max size: %d bytes)...\n", cfg.MaxContextSize)
-	selectedFiles, totalSize, err := client.SelectFiles(files, cfg.MaxContextSize)
+	// The first Ctrl-C cancels the run, keeping the sections already written
+	// for a rerun to reuse; a second one quits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	result, err := repocontext.Generate(ctx, opts)
 	if err != nil {
-		log.Fatal(err)
+		if ctx.Err() != nil {
+			interrupted()
+		}
+		fatal(err)
+	}
+	defer printWarnings(result.Warnings)
+	if *verbose {
+		defer printMissing(result.Missing)
 	}
 
-	fmt.Printf("\nSelected %d files for analysis (total size: %d bytes)\n", len(selectedFiles), totalSize)
+	if *promptDump != "" {
+		if err := dumpPrompts(result.Prompts, *promptDump); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-	// Create filtered map of selected files
-	selectedFilesMap := make(map[string]*git.RepoFile)
-	for _, path := range selectedFiles {
-		selectedFilesMap[path] = files[path]
+	if len(opts.Compare) > 0 {
+		for _, path := range result.Compared {
+			fmt.Println(path)
+		}
+		return
 	}
 
-	// Initialize documentation generator with versioned path
-	docGen, err := docs.New(repo.Path, commitHash, repo.Tag, client)
-	if err != nil {
-		log.Fatal(err)
+	if *selectOnly {
+		if err := printSelection(result.Importance, *jsonOutput); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
-	// Generate or load documentation
-	meta := &docs.Metadata{
-		CommitHash:  commitHash,
-		ModelUsed:   client.ModelName(),
-		GeneratedAt: time.Now(),
+	if *stdoutOnly || (*summaryOnly && !*jsonOutput) {
+		// A streamed summary has already been printed
+		if !*stream {
+			fmt.Print(result.Markdown)
+		}
+		return
 	}
 
-	fmt.Println("\nGenerating documentation...")
-	if err := docGen.LoadOrGenerateDocs(selectedFilesMap, meta); err != nil {
-		log.Fatal(err)
+	if err := printDocs(result, *jsonOutput); err != nil {
+		fatal(err)
 	}
+}
 
-	// Perform cleanup pass to remove duplicates
-	if err := docGen.CleanupDuplicates(); err != nil {
-		log.Fatal(err)
+// printWarnings repeats the run's warnings on stderr after all other output,
+// so they aren't lost among the progress messages.
+func printWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	noun := "warnings"
+	if len(warnings) == 1 {
+		noun = "warning"
 	}
+	fmt.Fprintf(os.Stderr, "\n%d %s:\n", len(warnings), noun)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "  - %s\n", warning)
+	}
+}
 
-	// Output the full documentation to stdout
-	fullDocPath := filepath.Join(docGen.DocsPath, docs.FullDocFileName)
-	fullDoc, err := os.ReadFile(fullDocPath)
-	if err != nil {
-		log.Fatal(err)
+// printMissing lists the paths the model selected that don't exist, ahead
+// of the warnings summary that counts them
+func printMissing(paths []string) {
+	if len(paths) == 0 {
+		return
 	}
+	fmt.Fprintf(os.Stderr, "\nFiles the model selected that don't exist:\n")
+	for _, path := range paths {
+		fmt.Fprintf(os.Stderr, "  - %s\n", filepath.ToSlash(path))
+	}
+}
+
+// isFlagSet reports whether a flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// dumpPrompts writes each prompt to stdout under a header, or with a
+// directory to <name>.prompt.txt files in it.
+func dumpPrompts(prompts []repocontext.Prompt, dir string) error {
+	if dir == "-" {
+		for _, prompt := range prompts {
+			fmt.Printf("==================== %s ====================\n\n", prompt.Name)
+			fmt.Printf("--- system ---\n%s\n\n--- user ---\n%s\n\n", prompt.System, prompt.Text)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fsError(fmt.Errorf("failed to create prompt directory: %w", err))
+	}
+	for _, prompt := range prompts {
+		base := strings.TrimSuffix(prompt.Name, filepath.Ext(prompt.Name))
+		if err := os.WriteFile(filepath.Join(dir, base+".system.txt"), []byte(prompt.System), 0644); err != nil {
+			return fsError(fmt.Errorf("failed to write system prompt: %w", err))
+		}
+		name := base + ".prompt.txt"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(prompt.Text), 0644); err != nil {
+			return fsError(fmt.Errorf("failed to write prompt: %w", err))
+		}
+		logger.Printf("Wrote %s (and %s.system.txt)\n", filepath.Join(dir, name), base)
+	}
+	return nil
+}
+
+// selectedFile is one entry of the --select-only --json output, and of the
+// selection in the --json documentation output
+type selectedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// selectedFiles lists the selection with each file's importance score, in
+// selection order
+func selectedFiles(importance []repocontext.Importance) []selectedFile {
+	entries := make([]selectedFile, len(importance))
+	for i, file := range importance {
+		entries[i] = selectedFile{Path: filepath.ToSlash(file.Path), Size: file.Size, Score: file.Score, Reason: file.Reason}
+	}
+	return entries
+}
 
-	versionPath := filepath.Join(repo.User, repo.Repo, "versions", commitHash)
-	fmt.Printf("\nDocumentation generated and saved to: %s\n", docGen.DocsPath)
-	fmt.Printf("Version: %s\n", versionPath)
-	fmt.Printf("Generated with: %s\n", meta.ModelUsed)
-	fmt.Printf("Generated at: %s\n", meta.GeneratedAt.Format(time.RFC3339))
-	fmt.Println("\n=== Generated Documentation ===\n")
-	fmt.Println(string(fullDoc))
+// printSelection writes the selected paths to stdout, in selection order
+func printSelection(importance []repocontext.Importance, jsonOutput bool) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(selectedFiles(importance))
+	}
+
+	for _, file := range importance {
+		fmt.Println(filepath.ToSlash(file.Path))
+	}
+	return nil
+}
+
+// printDocs writes the final documentation to stdout, either as JSON or as a
+// human-readable summary followed by the markdown.
+func printDocs(result *repocontext.Result, jsonOutput bool) error {
+	meta := result.Metadata
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jsonResult{
+			Repository:    result.Repository,
+			CommitHash:    meta.CommitHash,
+			DocsPath:      result.DocsPath,
+			ModelUsed:     meta.ModelUsed,
+			GeneratedAt:   meta.GeneratedAt,
+			WordCount:     meta.WordCount,
+			ReadingTime:   meta.ReadingMinutes,
+			Tags:          meta.Tags,
+			Warnings:      result.Warnings,
+			MissingPaths:  result.Missing,
+			Documentation: result.Markdown,
+			Sections:      result.Sections,
+			Selection:     selectedFiles(result.Importance),
+			Citations:     result.Citations,
+			Manifest:      result.Manifest,
+		})
+	}
+
+	logger.Printf("\nDocumentation generated and saved to: %s\n", result.DocsPath)
+	logger.Printf("Version: %s\n", result.VersionPath)
+	logger.Printf("Generated with: %s\n", meta.ModelUsed)
+	logger.Printf("Generated at: %s\n", meta.GeneratedAt.Format(time.RFC3339))
+	if meta.WordCount > 0 {
+		logger.Printf("Length: %d words, %d characters (about %d min read)\n", meta.WordCount, meta.CharCount, meta.ReadingMinutes)
+	}
+	if m := result.Manifest; m != nil {
+		logger.Printf("Manifest: %d entry points, %d directories, %d dependencies (manifest.json)\n", len(m.EntryPoints), len(m.Directories), len(m.Dependencies))
+	}
+	logger.Println("\n=== Generated Documentation ===")
+	logger.Println()
+	fmt.Println(result.Markdown)
+	return nil
+}
+
+// parseSince converts a --since value into a cutoff time. It accepts Go
+// durations ("72h"), whole days ("7d"), and dates ("2024-01-31" or RFC 3339).
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q: expected a duration (72h, 7d) or a date (2024-01-31)", value)
 }
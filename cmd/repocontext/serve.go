@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/config"
+	"github.com/johnknott/repocontext/internal/docs"
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/pkg/repocontext"
+)
+
+// shutdownTimeout bounds how long in-flight requests get after Ctrl-C
+const shutdownTimeout = 5 * time.Second
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Repo}} - {{.Current}}</title>
+<style>
+body { margin: 0; display: flex; font-family: system-ui, sans-serif; line-height: 1.5; }
+nav { width: 16rem; min-height: 100vh; padding: 1rem; background: #f5f5f5; box-sizing: border-box; }
+nav a { display: block; padding: 0.2rem 0; color: #333; text-decoration: none; }
+nav a.current { font-weight: bold; }
+main { flex: 1; max-width: 50rem; padding: 1rem 2rem; }
+pre { background: #f5f5f5; padding: 0.75rem; overflow-x: auto; }
+code { font-family: ui-monospace, monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: 0.3rem 0.6rem; }
+</style>
+</head>
+<body>
+<nav>
+<strong>{{.Repo}}</strong>
+{{range .Files}}<a href="/{{.}}"{{if eq . $.Current}} class="current"{{end}}>{{.}}</a>
+{{end}}</nav>
+<main>
+{{.Body}}
+</main>
+</body>
+</html>
+`))
+
+type page struct {
+	Repo    string
+	Files   []string
+	Current string
+	Body    template.HTML
+}
+
+// runServe implements `repocontext serve`: it generates or loads the docs
+// and serves them as HTML until interrupted. It returns the process exit
+// code.
+func runServe(args []string) int {
+	cfg, err := config.New()
+	if err != nil {
+		fatal(configError(err))
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := fs.Int("port", 8080, "port to listen on")
+	quiet := fs.Bool("quiet", false, "suppress progress output")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "model to generate documentation with")
+	fs.StringVar(&cfg.RepoDir, "repo-dir", cfg.RepoDir, "cache directory for clones and docs (default ~/.repocontext, or $REPOCONTEXT_HOME)")
+	fs.StringVar(&cfg.DocsDir, "docs-dir", cfg.DocsDir, "base directory docs are written to")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: repocontext serve [flags] user/repo[@tag|#branch][:subpath]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *quiet {
+		logger.SetLevel(logger.LevelQuiet)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := repocontext.Generate(ctx, repocontext.Options{Repo: fs.Arg(0), Config: cfg})
+	if err != nil {
+		fatal(err)
+	}
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("localhost:%d", *port),
+		Handler: docsHandler(fs.Arg(0), result.DocsPath),
+	}
+	go func() {
+		<-ctx.Done()
+		logger.Println("\nShutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Printf("\nServing documentation for %s at http://%s/ (Ctrl-C to stop)\n", fs.Arg(0), srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+	return 0
+}
+
+// docsHandler serves each markdown file in docsPath as an HTML page with a
+// sidebar linking them all. The root redirects to the full documentation.
+func docsHandler(repo, docsPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/")
+		if name == "" {
+			http.Redirect(w, req, "/"+docs.FullDocFileName, http.StatusFound)
+			return
+		}
+
+		files, err := markdownFiles(docsPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(files, name) {
+			http.NotFound(w, req)
+			return
+		}
+
+		content, err := os.ReadFile(filepath.Join(docsPath, name))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = pageTemplate.Execute(w, page{
+			Repo:    repo,
+			Files:   files,
+			Current: name,
+			Body:    template.HTML(docs.RenderHTML(string(content))),
+		})
+		if err != nil {
+			// The response has started, so the error can only be logged
+			fmt.Fprintf(os.Stderr, "Error rendering %s: %v\n", name, err)
+		}
+	})
+}
+
+// markdownFiles lists the docs in docsPath, sections first and full.md last
+func markdownFiles(docsPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(docsPath, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(matches))
+	for _, match := range matches {
+		files = append(files, filepath.Base(match))
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if (files[i] == docs.FullDocFileName) != (files[j] == docs.FullDocFileName) {
+			return files[j] == docs.FullDocFileName
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
@@ -1,30 +1,544 @@
 package config
 
 import (
+	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/johnknott/repocontext/internal/llm"
+	"github.com/johnknott/repocontext/internal/logger"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	DefaultMaxContextSize = 200000 // 200KB in bytes
+	DefaultSectionRetries = 2
+	DefaultModel          = "claude-3-5-sonnet-20241022"
+	DefaultProvider       = "anthropic"
+	DefaultDedupThreshold = 8000 // bytes; smaller docs are deduplicated without the LLM
+	DefaultSelectionFloor = 0.2  // warn when the selection uses less than this fraction of max size
+	DefaultMaxConcurrency = 2    // API requests in flight at once
+	DefaultMaxRepoSize    = 1024 // megabytes; larger repositories are refused before or after cloning
+
+	// DefaultContextWindow is the context limit in tokens assumed for models
+	// not in knownContextWindows, and BytesPerToken a rough conversion used to
+	// compare it with byte sizes.
+	DefaultContextWindow = 200000
+	BytesPerToken        = 4
+
+	UserConfigFile    = "config.yaml"       // under ~/.repocontext
+	ProjectConfigFile = ".repocontext.yaml" // in the working directory, and at the root of a documented repository
 )
 
+// knownContextWindows maps model name prefixes to their context limit in tokens
+var knownContextWindows = map[string]int{
+	"claude-3":         200000,
+	"claude-2.1":       200000,
+	"claude-2.0":       100000,
+	"claude-instant-1": 100000,
+}
+
+// ContextWindowFor returns the context limit in tokens for a model name.
+// Bedrock model IDs (e.g. us.anthropic.claude-3-haiku-20240307-v1:0) are
+// matched by the model name after the vendor.
+func ContextWindowFor(model string) int {
+	if _, name, ok := strings.Cut(model, "anthropic."); ok {
+		model = name
+	}
+	best, window := "", DefaultContextWindow
+	for prefix, tokens := range knownContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, window = prefix, tokens
+		}
+	}
+	return window
+}
+
+// Config holds all runtime settings. Values are resolved in increasing order
+// of precedence:
+//
+//  1. built-in defaults
+//  2. ~/.repocontext/config.yaml
+//  3. .repocontext.yaml in the current working directory
+//  4. environment variables
+//  5. command-line flags (applied by the caller after New)
+//
+// Missing config files are ignored, so env-only setups keep working.
 type Config struct {
-	MaxContextSize int
-	AnthropicKey   string
+	MaxContextSize int      `yaml:"max_size"`
+	AnthropicKey   string   `yaml:"-"`
+	AzureKey       string   `yaml:"-"`
+	AzureEndpoint  string   `yaml:"-"` // used as the base URL for azure unless one is set
+	AWSRegion      string   `yaml:"-"` // for bedrock, from AWS_REGION or AWS_DEFAULT_REGION
+	SectionRetries int      `yaml:"section_retries"`
+	Model          string   `yaml:"model"`
+	Models         []string `yaml:"models"` // fallback chain, tried in order; the first is Model
+	Provider       string   `yaml:"provider"`
+	BaseURL        string   `yaml:"base_url"`    // API endpoint; the Azure resource endpoint, or a gateway for anthropic (unused by bedrock)
+	APIVersion     string   `yaml:"api_version"` // Azure OpenAI API version
+	Sections       []string `yaml:"sections"`
+	FullSections   []string `yaml:"full_sections"` // sections assembled into full.md (default: all of Sections)
+	Include        []string `yaml:"include"`
+	Exclude        []string `yaml:"exclude"`
+	Proxy          string   `yaml:"proxy"` // overrides HTTPS_PROXY/HTTP_PROXY for clones and API calls
+	DedupThreshold int      `yaml:"dedup_threshold"`
+	Languages      []string `yaml:"languages"`
+	IncludeTests   bool     `yaml:"include_tests"`
+	DocsDir        string   `yaml:"docs_dir"` // base dir for docs, instead of next to the clone
+	RepoDir        string   `yaml:"repo_dir"` // cache root for clones and docs (default ~/.repocontext)
+	SelectionFloor float64  `yaml:"selection_floor"`
+	TopUp          bool     `yaml:"top_up"`         // fill a thin selection with heuristically ranked files
+	ContextWindow  int      `yaml:"context_window"` // tokens; 0 means the model's known limit
+
+	// Binary detection; zero values use the built-in defaults
+	BinaryEntropy   float64  `yaml:"binary_entropy"`    // bits per byte above which a file is binary
+	BinaryTextRatio float64  `yaml:"binary_text_ratio"` // minimum share of text characters
+	ForceText       []string `yaml:"force_text"`        // globs always treated as text
+
+	DocGlobs []string `yaml:"doc_globs"` // extra globs or extensions of documentation files, prioritized in selection
+
+	TruncateSize int `yaml:"truncate_size"` // bytes; larger files are cut to their first and last lines rather than left out (0 = off)
+
+	BinaryNames bool `yaml:"include_binary_names"` // list binary files by name and size in the overview tree
+
+	StripComments bool `yaml:"strip_comments"` // remove comments and license headers from files before prompting
+
+	Strict bool `yaml:"strict"` // fail when a file can't be read or classified, instead of warning and skipping it
+
+	CiteSource bool `yaml:"cite_source"` // quote source excerpts with file:line attributions in the usage section, verified after generation
+
+	Incremental bool `yaml:"incremental"` // write sections from per-file summaries cached by content hash
+
+	// Ownership hints in the overview, from the history fetched with History
+	Authors  bool `yaml:"authors"`   // name the recent authors of the key files
+	NoEmails bool `yaml:"no_emails"` // give author names only, without email addresses
+
+	RedactPatterns []string `yaml:"redact_patterns"` // extra regexps for secrets to mask in prompts
+	MaxConcurrency int      `yaml:"max_concurrency"` // API requests in flight at once
+	Tags           bool     `yaml:"tags"`            // extract topic tags with an extra model call
+	Dedup          bool     `yaml:"dedup"`           // run the cleanup pass that merges repeated material in full.md
+	MaxRepoSize    int      `yaml:"max_repo_size"`   // megabytes; 0 disables the limit
+	History        int      `yaml:"history"`         // commits of history to clone; 0 or 1 is a shallow clone
+
+	// Link checking of full.md after generation
+	CheckLinks        bool `yaml:"check_links"`
+	SkipExternalLinks bool `yaml:"skip_external_links"` // only check links to repository files
+	StrictLinks       bool `yaml:"strict_links"`        // fail the run on a broken link; implies CheckLinks
+
+	// Extra guidance appended to every section and cleanup prompt. A file
+	// takes precedence over inline text.
+	ExtraInstructions string `yaml:"extra_instructions"`
+	InstructionsFile  string `yaml:"instructions_file"`
+
+	Language string `yaml:"lang"` // documentation language, e.g. es (default English)
+
+	// Limits on streamed completions, in estimated tokens (0 = off)
+	SoftTokenCap int `yaml:"soft_token_cap"` // warn when a completion passes this
+	HardTokenCap int `yaml:"hard_token_cap"` // cancel a completion that passes this
+
+	// Completion token limits for individual sections, by section name,
+	// overriding the global default, e.g. overview: 6000
+	SectionTokens map[string]int `yaml:"section_tokens"`
 }
 
-func New() *Config {
+func New() (*Config, error) {
 	cfg := &Config{
 		MaxContextSize: DefaultMaxContextSize,
-		AnthropicKey:   os.Getenv("ANTHROPIC_API_KEY"),
+		SectionRetries: DefaultSectionRetries,
+		Model:          DefaultModel,
+		Provider:       DefaultProvider,
+		DedupThreshold: DefaultDedupThreshold,
+		SelectionFloor: DefaultSelectionFloor,
+		MaxConcurrency: DefaultMaxConcurrency,
+		Tags:           true,
+		Dedup:          true,
+		MaxRepoSize:    DefaultMaxRepoSize,
+	}
+
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if err := cfg.loadFile(filepath.Join(homeDir, ".repocontext", UserConfigFile)); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadFile(ProjectConfigFile); err != nil {
+		return nil, err
+	}
+
+	// A key file (e.g. a Docker secret) takes precedence over the inline key
+	cfg.AnthropicKey = os.Getenv("ANTHROPIC_API_KEY")
+	if keyFile := os.Getenv("ANTHROPIC_API_KEY_FILE"); keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ANTHROPIC_API_KEY_FILE: %w", err)
+		}
+		cfg.AnthropicKey = strings.TrimSpace(string(key))
+	}
+	cfg.AzureKey = os.Getenv("AZURE_OPENAI_API_KEY")
+	cfg.AzureEndpoint = os.Getenv("AZURE_OPENAI_ENDPOINT")
+	cfg.AWSRegion = os.Getenv("AWS_REGION")
+	if cfg.AWSRegion == "" {
+		cfg.AWSRegion = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if err := envSize("REPOCONTEXT_MAX_SIZE", &cfg.MaxContextSize); err != nil {
+		return nil, err
+	}
+	ints := []struct {
+		name, unit string
+		dst        *int
+	}{
+		{"REPOCONTEXT_SECTION_RETRIES", "", &cfg.SectionRetries},
+		{"REPOCONTEXT_DEDUP_THRESHOLD", "bytes", &cfg.DedupThreshold},
+		{"REPOCONTEXT_MAX_CONCURRENCY", "", &cfg.MaxConcurrency},
+		{"REPOCONTEXT_MAX_REPO_SIZE", "megabytes", &cfg.MaxRepoSize},
+		{"REPOCONTEXT_HISTORY", "commits", &cfg.History},
+		{"REPOCONTEXT_TRUNCATE_SIZE", "bytes", &cfg.TruncateSize},
+		{"REPOCONTEXT_SOFT_TOKEN_CAP", "tokens", &cfg.SoftTokenCap},
+		{"REPOCONTEXT_HARD_TOKEN_CAP", "tokens", &cfg.HardTokenCap},
+		{"REPOCONTEXT_CONTEXT_WINDOW", "tokens", &cfg.ContextWindow},
+	}
+	for _, setting := range ints {
+		if err := envInt(setting.name, setting.unit, setting.dst); err != nil {
+			return nil, err
+		}
+	}
+
+	// REPOCONTEXT_TOKENS_<SECTION>, e.g. REPOCONTEXT_TOKENS_GETTING_STARTED
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		section, ok := strings.CutPrefix(key, "REPOCONTEXT_TOKENS_")
+		if !ok || value == "" {
+			continue
+		}
+		var n int
+		if err := envInt(key, "tokens", &n); err != nil {
+			return nil, err
+		}
+		if cfg.SectionTokens == nil {
+			cfg.SectionTokens = make(map[string]int)
+		}
+		cfg.SectionTokens[strings.ToLower(section)] = n
+	}
+
+	if floor := os.Getenv("REPOCONTEXT_SELECTION_FLOOR"); floor != "" {
+		f, err := strconv.ParseFloat(floor, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REPOCONTEXT_SELECTION_FLOOR %q: must be a fraction such as 0.2", floor)
+		}
+		cfg.SelectionFloor = f
+	}
+
+	// A single model replaces any chain from a config file
+	if model := os.Getenv("REPOCONTEXT_MODEL"); model != "" {
+		cfg.Model = model
+		cfg.Models = nil
+	}
+	envList("REPOCONTEXT_MODELS", &cfg.Models)
+	if len(cfg.Models) > 0 {
+		cfg.Model = cfg.Models[0]
+	}
+
+	strs := []struct {
+		name string
+		dst  *string
+	}{
+		{"REPOCONTEXT_PROVIDER", &cfg.Provider},
+		{"REPOCONTEXT_BASE_URL", &cfg.BaseURL},
+		{"AZURE_OPENAI_API_VERSION", &cfg.APIVersion},
+		{"REPOCONTEXT_HOME", &cfg.RepoDir},
+		{"REPOCONTEXT_DOCS_DIR", &cfg.DocsDir},
+		{"REPOCONTEXT_PROXY", &cfg.Proxy},
+		{"REPOCONTEXT_DOC_LANG", &cfg.Language},
+		{"REPOCONTEXT_INSTRUCTIONS", &cfg.ExtraInstructions},
+		{"REPOCONTEXT_INSTRUCTIONS_FILE", &cfg.InstructionsFile},
+	}
+	for _, setting := range strs {
+		envString(setting.name, setting.dst)
+	}
+
+	lists := []struct {
+		name string
+		dst  *[]string
+	}{
+		{"REPOCONTEXT_SECTIONS", &cfg.Sections},
+		{"REPOCONTEXT_FULL_SECTIONS", &cfg.FullSections},
+		{"REPOCONTEXT_INCLUDE", &cfg.Include},
+		{"REPOCONTEXT_EXCLUDE", &cfg.Exclude},
+		{"REPOCONTEXT_LANGUAGES", &cfg.Languages},
+		{"REPOCONTEXT_FORCE_TEXT", &cfg.ForceText},
+		{"REPOCONTEXT_DOC_GLOBS", &cfg.DocGlobs},
+	}
+	for _, setting := range lists {
+		envList(setting.name, setting.dst)
+	}
+
+	if cfg.InstructionsFile != "" {
+		instructions, err := os.ReadFile(cfg.InstructionsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instructions file: %w", err)
+		}
+		cfg.ExtraInstructions = string(instructions)
+	}
+	cfg.ExtraInstructions = strings.TrimSpace(cfg.ExtraInstructions)
+
+	bools := []struct {
+		name string
+		dst  *bool
+	}{
+		{"REPOCONTEXT_DEDUP", &cfg.Dedup},
+		{"REPOCONTEXT_TAGS", &cfg.Tags},
+		{"REPOCONTEXT_INCLUDE_TESTS", &cfg.IncludeTests},
+		{"REPOCONTEXT_CHECK_LINKS", &cfg.CheckLinks},
+		{"REPOCONTEXT_SKIP_EXTERNAL_LINKS", &cfg.SkipExternalLinks},
+		{"REPOCONTEXT_STRICT_LINKS", &cfg.StrictLinks},
+		{"REPOCONTEXT_STRIP_COMMENTS", &cfg.StripComments},
+		{"REPOCONTEXT_AUTHORS", &cfg.Authors},
+		{"REPOCONTEXT_NO_EMAILS", &cfg.NoEmails},
+		{"REPOCONTEXT_STRICT", &cfg.Strict},
+		{"REPOCONTEXT_CITE_SOURCE", &cfg.CiteSource},
+		{"REPOCONTEXT_INCREMENTAL", &cfg.Incremental},
+		{"REPOCONTEXT_INCLUDE_BINARY_NAMES", &cfg.BinaryNames},
+	}
+	for _, setting := range bools {
+		if err := envBool(setting.name, setting.dst); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// envInt sets *dst from the environment variable name, if it's set. unit
+// names what the number counts in the error, e.g. "bytes".
+func envInt(name, unit string, dst *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		if unit != "" {
+			return fmt.Errorf("invalid %s %q: must be a whole number of %s", name, value, unit)
+		}
+		return fmt.Errorf("invalid %s %q: must be a whole number", name, value)
+	}
+	*dst = n
+	return nil
+}
+
+// envBool sets *dst from the environment variable name, if it's set
+func envBool(name string, dst *bool) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be true or false", name, value)
+	}
+	*dst = b
+	return nil
+}
+
+// envSize sets *dst from the environment variable name, if it's set, in
+// bytes or with a unit ParseSize accepts
+func envSize(name string, dst *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*dst = size
+	return nil
+}
+
+// envString sets *dst from the environment variable name, if it's set
+func envString(name string, dst *string) {
+	if value := os.Getenv(name); value != "" {
+		*dst = value
+	}
+}
+
+// envList sets *dst from the comma-separated environment variable name, if
+// it's set
+func envList(name string, dst *[]string) {
+	if value := os.Getenv(name); value != "" {
+		*dst = SplitList(value)
+	}
+}
+
+// Validate rejects settings that can't work, and warns about ones that are
+// allowed but probably not what the user meant.
+func (c *Config) Validate() error {
+	if c.MaxContextSize <= 0 {
+		return fmt.Errorf("max context size must be greater than 0 bytes, got %d", c.MaxContextSize)
+	}
+	if c.SectionRetries < 0 {
+		return fmt.Errorf("section retries must not be negative, got %d", c.SectionRetries)
+	}
+	if c.MaxConcurrency < 1 {
+		return fmt.Errorf("max concurrency must be at least 1, got %d", c.MaxConcurrency)
+	}
+	if c.SelectionFloor < 0 || c.SelectionFloor > 1 {
+		return fmt.Errorf("selection floor must be between 0 and 1, got %g", c.SelectionFloor)
+	}
+
+	if c.BinaryEntropy < 0 || c.BinaryEntropy > 8 {
+		return fmt.Errorf("binary entropy threshold must be between 0 and 8 bits per byte, got %g", c.BinaryEntropy)
+	}
+	if c.BinaryTextRatio < 0 || c.BinaryTextRatio > 1 {
+		return fmt.Errorf("binary text ratio must be between 0 and 1, got %g", c.BinaryTextRatio)
+	}
+	if c.MaxRepoSize < 0 {
+		return fmt.Errorf("max repository size must not be negative, got %d MB", c.MaxRepoSize)
+	}
+	if c.History < 0 {
+		return fmt.Errorf("history must not be negative, got %d commits", c.History)
+	}
+	if c.ContextWindow < 0 {
+		return fmt.Errorf("context window must not be negative, got %d", c.ContextWindow)
+	}
+	if c.TruncateSize < 0 {
+		return fmt.Errorf("truncate size must not be negative, got %d bytes", c.TruncateSize)
+	}
+	if c.TruncateSize > c.MaxContextSize {
+		logger.Warnf("truncate size %d bytes exceeds the max context size of %d bytes; a truncated file can still fill the budget\n", c.TruncateSize, c.MaxContextSize)
+	}
+	if c.SoftTokenCap < 0 || c.HardTokenCap < 0 {
+		return fmt.Errorf("token caps must not be negative, got %d and %d", c.SoftTokenCap, c.HardTokenCap)
+	}
+	if c.SoftTokenCap > 0 && c.HardTokenCap > 0 && c.SoftTokenCap >= c.HardTokenCap {
+		return fmt.Errorf("soft token cap %d must be below the hard token cap %d", c.SoftTokenCap, c.HardTokenCap)
 	}
 
-	if maxSize := os.Getenv("REPOCONTEXT_MAX_SIZE"); maxSize != "" {
-		if size, err := strconv.Atoi(maxSize); err == nil {
-			cfg.MaxContextSize = size
+	if limit := c.EffectiveContextWindow() * BytesPerToken; c.MaxContextSize > limit {
+		logger.Warnf("max context size %d bytes exceeds the context window of %d tokens (~%d bytes); generation may fail\n",
+			c.MaxContextSize, c.EffectiveContextWindow(), limit)
+	}
+
+	return nil
+}
+
+// ModelChain returns the models to try in order: Models if set, otherwise
+// just Model.
+func (c *Config) ModelChain() []string {
+	if len(c.Models) > 0 {
+		return c.Models
+	}
+	return []string{c.Model}
+}
+
+// Backend returns the endpoint and credentials for the configured provider
+func (c *Config) Backend() llm.Backend {
+	backend := llm.Backend{Provider: c.Provider, BaseURL: c.BaseURL, APIVersion: c.APIVersion}
+	switch c.Provider {
+	case llm.ProviderAzure:
+		backend.APIKey = c.AzureKey
+		if backend.BaseURL == "" {
+			backend.BaseURL = c.AzureEndpoint
+		}
+	case llm.ProviderBedrock:
+		backend.Region = c.AWSRegion
+	default:
+		backend.APIKey = c.AnthropicKey
+	}
+	return backend
+}
+
+// EffectiveContextWindow returns the configured context window, or the
+// model's known limit when none is set.
+func (c *Config) EffectiveContextWindow() int {
+	if c.ContextWindow > 0 {
+		return c.ContextWindow
+	}
+	return ContextWindowFor(c.Model)
+}
+
+// loadFile overlays values from a YAML config file, ignoring missing files
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ParseSectionTokens parses a comma-separated list of section=tokens pairs,
+// as given to --section-tokens
+func ParseSectionTokens(value string) (map[string]int, error) {
+	tokens := make(map[string]int)
+	for _, pair := range SplitList(value) {
+		name, n, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid section token limit %q: use section=tokens, e.g. overview=6000", pair)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil {
+			return nil, fmt.Errorf("invalid section token limit %q: must be a whole number of tokens", pair)
+		}
+		tokens[strings.TrimSpace(name)] = limit
+	}
+	return tokens, nil
+}
+
+// SplitList splits a comma-separated value, dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
+}
+
+// sizeUnits are the multipliers ParseSize accepts, lowercased. k, KB and MB
+// are decimal, as in "200k meaning 200000"; KiB and MiB are binary.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+}
 
-	return cfg
+// ParseSize parses a byte count, either a plain number ("200000") or one
+// with a unit ("200KB", "500k", "1.5MB", "64KiB")
+func ParseSize(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	digits := strings.TrimRightFunc(value, unicode.IsLetter)
+	unit := strings.ToLower(strings.TrimSpace(value[len(digits):]))
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q in %q: use k, KB, MB, KiB or MiB, or a plain number of bytes", value[len(digits):], value)
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(digits), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: must be a number of bytes, optionally with a unit such as 200KB or 1MB", value)
+	}
+	bytes := n * multiplier
+	if bytes != math.Trunc(bytes) {
+		return 0, fmt.Errorf("invalid size %q: must be a whole number of bytes", value)
+	}
+	if bytes > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid size %q: too large", value)
+	}
+	return int(bytes), nil
 }
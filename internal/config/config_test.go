@@ -0,0 +1,71 @@
+package config
+
+import "testing"
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		value   string
+		unit    string
+		want    int
+		wantErr string
+	}{
+		{"", "bytes", 7, ""},
+		{"42", "bytes", 42, ""},
+		{"4k", "bytes", 7, `invalid REPOCONTEXT_TEST "4k": must be a whole number of bytes`},
+		{"x", "", 7, `invalid REPOCONTEXT_TEST "x": must be a whole number`},
+	}
+	for _, tt := range tests {
+		t.Setenv("REPOCONTEXT_TEST", tt.value)
+		n := 7
+		err := envInt("REPOCONTEXT_TEST", tt.unit, &n)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("envInt(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("envInt(%q): %v", tt.value, err)
+		}
+		if n != tt.want {
+			t.Errorf("envInt(%q) set %d, want %d", tt.value, n, tt.want)
+		}
+	}
+}
+
+func TestEnvBool(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"false", false, false},
+		{"1", true, false},
+		{"yes", true, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("REPOCONTEXT_TEST", tt.value)
+		b := true
+		err := envBool("REPOCONTEXT_TEST", &b)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("envBool(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+		if err != nil && err.Error() != `invalid REPOCONTEXT_TEST "yes": must be true or false` {
+			t.Errorf("envBool(%q) error = %q", tt.value, err)
+		}
+		if b != tt.want {
+			t.Errorf("envBool(%q) set %v, want %v", tt.value, b, tt.want)
+		}
+	}
+}
+
+func TestEnvSize(t *testing.T) {
+	t.Setenv("REPOCONTEXT_TEST", "200KB")
+	n := 0
+	if err := envSize("REPOCONTEXT_TEST", &n); err != nil || n != 200000 {
+		t.Errorf("envSize(200KB) = %d, %v", n, err)
+	}
+	t.Setenv("REPOCONTEXT_TEST", "lots")
+	if err := envSize("REPOCONTEXT_TEST", &n); err == nil {
+		t.Error("envSize(lots) succeeded, want an error")
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfig holds the settings a repository may ship in a .repocontext.yaml
+// at its root, so a project's docs are generated the same way whoever runs
+// the tool. Keys, endpoints, proxies, local paths and size limits are left
+// out: documenting a repository must not redirect requests, read the user's
+// files or lift their limits.
+type RepoConfig struct {
+	Model             string         `yaml:"model"`
+	Models            []string       `yaml:"models"`
+	Sections          []string       `yaml:"sections"`
+	FullSections      []string       `yaml:"full_sections"`
+	SectionTokens     map[string]int `yaml:"section_tokens"`
+	Include           []string       `yaml:"include"`
+	Exclude           []string       `yaml:"exclude"`
+	Languages         []string       `yaml:"languages"`
+	IncludeTests      bool           `yaml:"include_tests"`
+	DocGlobs          []string       `yaml:"doc_globs"`
+	ForceText         []string       `yaml:"force_text"`
+	StripComments     bool           `yaml:"strip_comments"`
+	CiteSource        bool           `yaml:"cite_source"`
+	ExtraInstructions string         `yaml:"extra_instructions"`
+	Language          string         `yaml:"lang"`
+}
+
+// repoConfigKeys are the keys RepoConfig accepts
+var repoConfigKeys = []string{
+	"model", "models", "sections", "full_sections", "section_tokens", "include", "exclude", "languages",
+	"include_tests", "doc_globs", "force_text", "strip_comments", "cite_source", "extra_instructions", "lang",
+}
+
+// LoadRepoConfig reads the .repocontext.yaml at the root of a checkout,
+// returning nil if there is none. Keys a repository may not set are
+// returned as ignored, for the caller to warn about.
+func LoadRepoConfig(root string) (*RepoConfig, []string, error) {
+	path := filepath.Join(root, ProjectConfigFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", ProjectConfigFile, err)
+	}
+
+	var keys map[string]any
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", ProjectConfigFile, err)
+	}
+	repoCfg := &RepoConfig{}
+	if err := yaml.Unmarshal(data, repoCfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", ProjectConfigFile, err)
+	}
+
+	var ignored []string
+	for key := range keys {
+		if !slices.Contains(repoConfigKeys, key) {
+			ignored = append(ignored, key)
+		}
+	}
+	slices.Sort(ignored)
+	return repoCfg, ignored, nil
+}
+
+// ApplyRepo fills in the settings a repository's config sets that are still
+// at their built-in defaults, so the user's config files, environment and
+// flags take precedence over it. It returns the keys taken from the
+// repository. A setting given its default value explicitly, such as
+// --include-tests=false, can't be told apart from one left unset.
+func (c *Config) ApplyRepo(repo *RepoConfig) []string {
+	var applied []string
+	setList := func(key string, dst *[]string, src []string) {
+		if len(*dst) == 0 && len(src) > 0 {
+			*dst = src
+			applied = append(applied, key)
+		}
+	}
+	setBool := func(key string, dst *bool, src bool) {
+		if !*dst && src {
+			*dst = true
+			applied = append(applied, key)
+		}
+	}
+	setString := func(key string, dst *string, src string) {
+		if *dst == "" && src != "" {
+			*dst = src
+			applied = append(applied, key)
+		}
+	}
+
+	if c.Model == DefaultModel && len(c.Models) == 0 {
+		if len(repo.Models) > 0 {
+			c.Models, c.Model = repo.Models, repo.Models[0]
+			applied = append(applied, "models")
+		} else if repo.Model != "" && repo.Model != c.Model {
+			c.Model = repo.Model
+			applied = append(applied, "model")
+		}
+	}
+	setList("sections", &c.Sections, repo.Sections)
+	setList("full_sections", &c.FullSections, repo.FullSections)
+	setList("include", &c.Include, repo.Include)
+	setList("exclude", &c.Exclude, repo.Exclude)
+	setList("languages", &c.Languages, repo.Languages)
+	setList("doc_globs", &c.DocGlobs, repo.DocGlobs)
+	setList("force_text", &c.ForceText, repo.ForceText)
+	setBool("include_tests", &c.IncludeTests, repo.IncludeTests)
+	setBool("strip_comments", &c.StripComments, repo.StripComments)
+	setBool("cite_source", &c.CiteSource, repo.CiteSource)
+	setString("extra_instructions", &c.ExtraInstructions, strings.TrimSpace(repo.ExtraInstructions))
+	setString("lang", &c.Language, repo.Language)
+
+	// Per-section limits merge, the user's winning for the same section
+	if tokens := maps.Clone(repo.SectionTokens); len(tokens) > 0 {
+		maps.Copy(tokens, c.SectionTokens)
+		if len(tokens) > len(c.SectionTokens) {
+			c.SectionTokens = tokens
+			applied = append(applied, "section_tokens")
+		}
+	}
+	return applied
+}
@@ -0,0 +1,207 @@
+package docs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// citationLine matches the attribution opening a cited excerpt, such as
+// "// from path/to/file.go:123" or "# from app.py:12" in the excerpt's own
+// comment syntax
+var citationLine = regexp.MustCompile(`^\s*(?://|#|--|;|<!--)\s*from\s+(\S+):(\d+)`)
+
+// citationInstruction asks for the usage section's examples to be quoted
+// from the source with attributions CheckCitations can verify
+const citationInstruction = `
+
+Quote the actual code from the repository files for each example rather than paraphrasing or writing new code. Put each quote in a fenced code block whose first line attributes it, in the language's comment syntax: "// from path/to/file.go:123" (or "# from path/to/file.py:123"), giving the file's path as listed above and the line the excerpt starts on. Copy the quoted lines exactly; mark any lines you leave out with a line containing only "...".`
+
+// CitationProblem is a cited excerpt in full.md that doesn't match the
+// repository's source
+type CitationProblem struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// citation is a fenced excerpt with its attribution
+type citation struct {
+	path    string
+	line    int
+	excerpt []string
+}
+
+// CheckCitations verifies every attributed excerpt in full.md against the
+// repository: the file must exist, the quoted lines must appear in it in
+// order, and the cited line must fall within them. Each problem is logged
+// as a warning.
+func (g *Generator) CheckCitations() ([]CitationProblem, error) {
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read full documentation: %w", err)
+	}
+
+	var problems []CitationProblem
+	citations := extractCitations(content)
+	for _, c := range citations {
+		if reason := g.checkCitation(c); reason != "" {
+			problems = append(problems, CitationProblem{Path: c.path, Line: c.line, Reason: reason})
+		}
+	}
+
+	for _, problem := range problems {
+		logger.Warnf("unverified citation in %s: %s:%d (%s)\n", FullDocFileName, problem.Path, problem.Line, problem.Reason)
+	}
+	logger.Verbosef("Checked %d citations, %d unverified\n", len(citations), len(problems))
+	return problems, nil
+}
+
+// extractCitations returns the fenced code blocks whose first line is an
+// attribution, with the lines quoted below it
+func extractCitations(content string) []citation {
+	var citations []citation
+	var current *citation
+	inFence, first := false, false
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			if inFence && current != nil {
+				citations = append(citations, *current)
+			}
+			inFence, first, current = !inFence, true, nil
+			continue
+		}
+		if !inFence {
+			continue
+		}
+		if first {
+			first = false
+			if match := citationLine.FindStringSubmatch(line); match != nil {
+				n, _ := strconv.Atoi(match[2])
+				current = &citation{path: strings.TrimSuffix(match[1], "-->"), line: n}
+				continue
+			}
+		}
+		if current != nil {
+			current.excerpt = append(current.excerpt, line)
+		}
+	}
+	return citations
+}
+
+// checkCitation returns why a citation doesn't match the source, or "" if
+// it does
+func (g *Generator) checkCitation(c citation) string {
+	clean := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(c.path, "/")))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "points outside the repository"
+	}
+	data, err := os.ReadFile(filepath.Join(g.RepoPath, clean))
+	if err != nil {
+		return "no such file in the repository"
+	}
+
+	start, end := findExcerpt(string(data), c.excerpt)
+	if start == 0 && g.StripComments {
+		// The model saw the file without comments, so may quote lines that
+		// had comments between them; only the content can be checked
+		if start, _ = findExcerpt(git.StripComments(clean, string(data)), c.excerpt); start > 0 {
+			return ""
+		}
+	}
+	switch {
+	case start == 0:
+		return "excerpt not found in the file"
+	case start == end && c.line != start:
+		return fmt.Sprintf("excerpt is at line %d", start)
+	case c.line < start || c.line > end:
+		return fmt.Sprintf("excerpt is at lines %d-%d", start, end)
+	}
+	return ""
+}
+
+// findExcerpt locates excerpt in source, ignoring indentation and blank
+// lines, with "..." lines standing for omitted code. It returns the 1-based
+// lines the excerpt spans, or zeros if it isn't there.
+func findExcerpt(source string, excerpt []string) (int, int) {
+	type sourceLine struct {
+		number int
+		text   string
+	}
+	var lines []sourceLine
+	for i, line := range strings.Split(source, "\n") {
+		if text := strings.TrimSpace(line); text != "" {
+			lines = append(lines, sourceLine{i + 1, text})
+		}
+	}
+
+	// Runs of quoted lines, split where code was left out
+	var chunks [][]string
+	var chunk []string
+	for _, line := range excerpt {
+		text := strings.TrimSpace(line)
+		switch {
+		case isElision(text):
+			if len(chunk) > 0 {
+				chunks = append(chunks, chunk)
+			}
+			chunk = nil
+		case text != "":
+			chunk = append(chunk, text)
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		return 0, 0
+	}
+
+	// Each run must follow the one before it
+	matchAt := func(i int, chunk []string) bool {
+		if i+len(chunk) > len(lines) {
+			return false
+		}
+		for j, text := range chunk {
+			if lines[i+j].text != text {
+				return false
+			}
+		}
+		return true
+	}
+	for first := range lines {
+		if !matchAt(first, chunks[0]) {
+			continue
+		}
+		next, ok := first+len(chunks[0]), true
+		for _, chunk := range chunks[1:] {
+			for next < len(lines) && !matchAt(next, chunk) {
+				next++
+			}
+			if next == len(lines) {
+				ok = false
+				break
+			}
+			next += len(chunk)
+		}
+		if ok {
+			return lines[first].number, lines[next-1].number
+		}
+	}
+	return 0, 0
+}
+
+// isElision reports whether a quoted line only marks omitted code
+func isElision(text string) bool {
+	for _, prefix := range []string{"//", "#", "--", ";", "/*"} {
+		text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+	return text == "..." || text == "…"
+}
@@ -0,0 +1,71 @@
+package docs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// CompareDirName is the docs subdirectory holding model comparisons
+const CompareDirName = "compare"
+
+// Compare generates each section once with each client, for evaluating
+// models side by side. Outputs are written to compare/ as
+// <section>.<label>.md, labels naming the clients in order. Nothing else is
+// written: there is no full.md, cleanup pass or metadata, and earlier
+// comparisons are overwritten. It returns the paths written.
+func (g *Generator) Compare(ctx context.Context, files map[string]*git.RepoFile, clients []LLMClient, labels []string) ([]string, error) {
+	if err := g.loadFiles(files); err != nil {
+		return nil, err
+	}
+	if err := g.fitFiles(g.sectionPrompts); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(g.DocsPath, CompareDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create comparison directory: %w", fileError(err))
+	}
+
+	primary := g.LLMClient
+	defer func() { g.LLMClient = primary }()
+
+	var written []string
+	for _, section := range g.Sections {
+		for i, client := range clients {
+			logger.Printf("\nComparing %s: %s\n", sectionName(section), labels[i])
+			g.LLMClient = client
+			content, _, err := g.generateSection(ctx, section)
+			if err != nil {
+				return written, fmt.Errorf("failed to generate section %s with %s: %w", section, labels[i], err)
+			}
+
+			path := filepath.Join(dir, sectionName(section)+"."+compareLabel(labels[i])+".md")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return written, fmt.Errorf("failed to write comparison: %w", fileError(err))
+			}
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
+
+// sectionName returns the config name of a section file, e.g. overview
+func sectionName(file string) string {
+	for name, f := range sectionFiles {
+		if f == file {
+			return name
+		}
+	}
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// compareLabel makes a model name safe to use in a file name
+func compareLabel(label string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(label)
+}
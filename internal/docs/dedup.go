@@ -0,0 +1,65 @@
+package docs
+
+import (
+	"crypto/sha256"
+	"strings"
+)
+
+const (
+	DedupMethodLocal = "local"
+	DedupMethodLLM   = "llm"
+)
+
+// dedupLocally removes paragraphs and headings that appear more than once,
+// keeping the first occurrence. Fenced code blocks are kept whole so they are
+// never split or partially dropped.
+func dedupLocally(content string) string {
+	seen := make(map[[32]byte]bool)
+	var kept []string
+	for _, block := range splitBlocks(content) {
+		key := sha256.Sum256([]byte(strings.Join(strings.Fields(block), " ")))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, block)
+	}
+	return strings.Join(kept, "\n\n") + "\n"
+}
+
+// splitBlocks splits markdown into blank-line separated blocks, with each
+// heading as its own block.
+func splitBlocks(content string) []string {
+	var blocks []string
+	var current []string
+	inFence := false
+
+	flush := func() {
+		if block := strings.TrimSpace(strings.Join(current, "\n")); block != "" {
+			blocks = append(blocks, block)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			inFence = !inFence
+			current = append(current, line)
+		case inFence:
+			current = append(current, line)
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			current = append(current, line)
+			flush()
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	return blocks
+}
@@ -3,52 +3,247 @@ package docs
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
 )
 
+// MetadataSchemaVersion is bumped whenever Metadata changes shape. Cached
+// metadata from an older version is migrated if possible, otherwise the
+// docs are regenerated.
+const MetadataSchemaVersion = 1
+
 type Metadata struct {
+	SchemaVersion int `json:"schema_version"`
+
 	CommitHash   string            `json:"commit_hash"`
 	GeneratedAt  time.Time         `json:"generated_at"`
 	ModelUsed    string            `json:"model_used"`
 	FileVersions map[string]string `json:"file_versions"`
 	Deduplicated bool              `json:"deduplicated"` // Add this field
+	DedupMethod  string            `json:"dedup_method,omitempty"`
+	DedupHash    string            `json:"dedup_hash,omitempty"` // hash of the cleaned full.md, see saveCleaned
+
+	TotalLines      int            `json:"total_lines,omitempty"`
+	LinesByLanguage map[string]int `json:"lines_by_language,omitempty"`
+
+	WordCount      int `json:"word_count,omitempty"`
+	CharCount      int `json:"char_count,omitempty"`
+	ReadingMinutes int `json:"reading_minutes,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
+
+	SectionModels map[string]string `json:"section_models,omitempty"` // section file -> model that wrote it
+	FullSections  []string          `json:"full_sections,omitempty"`  // sections assembled into full.md
+	Language      string            `json:"language,omitempty"`       // documentation language; empty is English
+
+	PostProcessed bool `json:"post_processed,omitempty"` // full.md is command output; the original is in UnprocessedFileName
 }
 
 type Generator struct {
-	RepoPath  string
-	DocsPath  string
-	Files     map[string]string // filepath -> content
-	LLMClient LLMClient
-	Meta      *Metadata
+	RepoPath       string
+	DocsPath       string
+	Files          map[string]string // filepath -> content
+	LLMClient      LLMClient
+	Meta           *Metadata
+	SectionRetries int                 // extra attempts when a section comes back invalid
+	Sections       []string            // section file names to generate, in order
+	FullSections   []string            // sections assembled into full.md (nil = all of Sections)
+	Stream         io.Writer           // if set, sections are echoed here as they're generated
+	DedupThreshold int                 // docs smaller than this many bytes are deduplicated locally
+	MaxTokens      int                 // completion token limit, used to detect truncated sections
+	SectionTokens  map[string]int      // section file -> completion token limit overriding MaxTokens
+	ContextWindow  int                 // model context limit in tokens; files are trimmed so prompts fit (0 = unchecked)
+	Frontmatter    bool                // prepend YAML frontmatter to each written doc file
+	Instructions   string              // extra guidance appended to every section and cleanup prompt
+	Language       string              // documentation language from NormalizeLanguage ("" = English)
+	Identical      map[string][]string // file path -> byte-identical copies left out of the prompt
+	Binaries       map[string]int64    // binary file path -> size, listed in the tree but never read
+	RepoName       string              // user/repo, recorded in frontmatter and used to recognise profile repos
+	SummaryDir     string              // if set, sections are written from per-file summaries cached here
+	Redact         []*regexp.Regexp    // secret patterns masked before files reach a prompt
+	StripComments  bool                // remove comments and license headers from files before prompting
+	Strict         bool                // fail on a selected file that can't be read instead of skipping it
+	TruncateSize   int                 // cut files larger than this many bytes to their first and last lines (0 = off)
+	Parallel       bool                // generate sections concurrently (ignored when streaming)
+	Commits        []string            // recent commit messages, newest first, for the changelog section
+	Authors        map[string][]string // key file path -> its primary authors, most recent first, hinted in the overview prompt
+	CiteSource     bool                // have the usage section quote source excerpts with file:line attributions
+
+	frameworks []string // detected from manifests, hinted in the overview prompt
+
+	truncated map[string]int // path -> size before TruncateSize cut it, noted in the prompts
 }
 
+// LLMClient sends a system message framing the model's role, and a user
+// prompt carrying the task and repository contents
 type LLMClient interface {
-	GenerateWithStream(ctx context.Context, prompt string) (string, error)
+	GenerateWithStream(ctx context.Context, system, prompt string, stream io.Writer) (string, error)
+	// GenerateWithModel limits the completion to maxTokens (0 = the client's
+	// default) and also reports which model produced it
+	GenerateWithModel(ctx context.Context, system, prompt string, maxTokens int, stream io.Writer) (string, string, error)
 }
 
+// systemPrompt is the system message for every documentation request. The
+// prompt builders supply the user message: the task and the file contents.
+const systemPrompt = `You are a documentation generator for software repositories. You write accurate, well-structured markdown for developers, based only on the repository files you are given.
+
+- Use real code from the repository for examples; never invent files, APIs or options.
+- Say so when something can't be determined from the files rather than guessing.
+- Reply with the requested content only, without preamble or closing remarks.`
+
 const (
 	OverviewFileName       = "01_overview.md"
 	GettingStartedFileName = "02_getting_started.md"
 	UsageFileName          = "03_usage.md"
+	ChangelogFileName      = "05_changelog.md"
 	FullDocFileName        = "full.md"
+	SummaryFileName        = "summary.md"
 	MetadataFileName       = "metadata.json"
+	SourcesFileName        = "sources.json"
+	ManifestFileName       = "manifest.json"
+
+	invalidSnippetLength = 200
+	maxContinuations     = 3
+	bytesPerToken        = 4 // rough estimate for English text and code
 )
 
-func New(repoPath string, commitHash string, tag string, llmClient LLMClient) (*Generator, error) {
+// sectionFiles maps the section names used in config to their file names
+var sectionFiles = map[string]string{
+	"overview":        OverviewFileName,
+	"getting_started": GettingStartedFileName,
+	"usage":           UsageFileName,
+	"changelog":       ChangelogFileName,
+}
+
+// DefaultSections lists the sections generated when none are configured, in
+// document order
+var DefaultSections = []string{OverviewFileName, GettingStartedFileName, UsageFileName}
+
+// sectionOrder lists every section, including optional ones, in document
+// order
+var sectionOrder = append(append([]string{}, DefaultSections...), ChangelogFileName)
+
+// ResolveSections converts configured section names into section file names,
+// keeping document order. An empty list selects the default sections.
+func ResolveSections(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return DefaultSections, nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		file, ok := sectionFiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %q (valid: overview, getting_started, usage, changelog)", name)
+		}
+		wanted[file] = true
+	}
+
+	var sections []string
+	for _, file := range sectionOrder {
+		if wanted[file] {
+			sections = append(sections, file)
+		}
+	}
+	return sections, nil
+}
+
+// Section is one generated section of the documentation
+type Section struct {
+	Name     string `json:"name"`     // config name, e.g. getting_started
+	File     string `json:"file"`     // file name in the docs directory
+	Markdown string `json:"markdown"` // content without frontmatter
+}
+
+// LoadSections reads the generated sections in docsPath in document order,
+// leaving out any that weren't generated
+func LoadSections(docsPath string) ([]Section, error) {
+	var sections []Section
+	for _, file := range sectionOrder {
+		content, err := os.ReadFile(filepath.Join(docsPath, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read section %s: %w", file, fileError(err))
+		}
+		sections = append(sections, Section{
+			Name:     sectionName(file),
+			File:     file,
+			Markdown: stripFrontmatter(string(content)),
+		})
+	}
+	return sections, nil
+}
+
+// ResolveSectionTokens converts per-section completion token limits, keyed
+// by section name, into limits keyed by section file name
+func ResolveSectionTokens(limits map[string]int) (map[string]int, error) {
+	resolved := make(map[string]int, len(limits))
+	for name, tokens := range limits {
+		file, ok := sectionFiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %q in token limits (valid: overview, getting_started, usage, changelog)", name)
+		}
+		if tokens <= 0 {
+			return nil, fmt.Errorf("token limit for section %s must be greater than 0, got %d", name, tokens)
+		}
+		resolved[file] = tokens
+	}
+	return resolved, nil
+}
+
+// ResolveFullSections converts the section names to assemble into full.md
+// into file names, keeping document order. Each must be one of the generated
+// sections; an empty list assembles all of them.
+func ResolveFullSections(names, sections []string) ([]string, error) {
+	if len(names) == 0 {
+		return sections, nil
+	}
+
+	resolved, err := ResolveSections(names)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range resolved {
+		if !slices.Contains(sections, file) {
+			return nil, fmt.Errorf("full.md section %s is not one of the generated sections", file)
+		}
+	}
+	return resolved, nil
+}
+
+// DocsDir returns where docs for the checkout at repoPath are stored
+func DocsDir(repoPath string) string {
 	// repoPath is the src directory, go up one level to get the version directory
 	versionDir := filepath.Dir(repoPath)
-	docsPath := filepath.Join(versionDir, "docs")
+	return filepath.Join(versionDir, "docs")
+}
+
+// New creates a generator reading sources from repoPath and writing docs to
+// docsPath, which defaults to DocsDir(repoPath) when empty.
+func New(repoPath, docsPath string, llmClient LLMClient) (*Generator, error) {
+	if docsPath == "" {
+		docsPath = DocsDir(repoPath)
+	}
 
 	if err := os.MkdirAll(docsPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create docs directory: %w", err)
+		return nil, fmt.Errorf("failed to create docs directory: %w", fileError(err))
 	}
 
 	return &Generator{
@@ -56,107 +251,408 @@ func New(repoPath string, commitHash string, tag string, llmClient LLMClient) (*
 		DocsPath:  docsPath,
 		LLMClient: llmClient,
 		Files:     make(map[string]string),
+		Sections:  DefaultSections,
 	}, nil
 }
 
-func (g *Generator) LoadOrGenerateDocs(files map[string]*git.RepoFile, meta *Metadata) error {
+func (g *Generator) LoadOrGenerateDocs(ctx context.Context, files map[string]*git.RepoFile, meta *Metadata) error {
 	if g.isCacheValid() {
-		fmt.Println("Using cached documentation...")
+		logger.Println("Using cached documentation...")
 		return g.loadFromCache()
 	}
 
 	g.Meta = meta
-	if err := g.generateDocs(files); err != nil {
+	g.Meta.Language = g.Language
+	if err := g.generateDocs(ctx, files); err != nil {
 		return err
 	}
 
 	// Don't set Deduplicated here - that will be done in CleanupDuplicates
 
 	// Save metadata
-	return g.saveMetadata()
+	if err := g.saveMetadata(); err != nil {
+		return err
+	}
+	return g.clearProgress()
 }
 
-func (g *Generator) isCacheValid() bool {
-	metaPath := filepath.Join(g.DocsPath, MetadataFileName)
-	data, err := os.ReadFile(metaPath)
+// LoadMetadata reads the metadata saved alongside generated docs
+func LoadMetadata(docsPath string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(docsPath, MetadataFileName))
 	if err != nil {
-		return false
+		return nil, err
 	}
 
 	var meta Metadata
 	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	if err := migrateMetadata(&meta); err != nil {
+		return nil, err
+	}
+	if meta.CommitHash == "" {
+		return nil, fmt.Errorf("invalid metadata: missing commit_hash")
+	}
+	return &meta, nil
+}
+
+// metadataMigrations upgrade metadata from the keyed version to the next
+var metadataMigrations = map[int]func(*Metadata){
+	// Unversioned files already have the version 1 fields
+	0: func(meta *Metadata) {},
+}
+
+// migrateMetadata brings meta up to MetadataSchemaVersion, failing for
+// versions it can't convert, including ones written by a newer release.
+func migrateMetadata(meta *Metadata) error {
+	for meta.SchemaVersion < MetadataSchemaVersion {
+		migrate, ok := metadataMigrations[meta.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("unsupported metadata schema version %d", meta.SchemaVersion)
+		}
+		migrate(meta)
+		meta.SchemaVersion++
+	}
+	if meta.SchemaVersion > MetadataSchemaVersion {
+		return fmt.Errorf("metadata schema version %d is newer than supported version %d", meta.SchemaVersion, MetadataSchemaVersion)
+	}
+	return nil
+}
+
+func (g *Generator) isCacheValid() bool {
+	meta, err := LoadMetadata(g.DocsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Printf("Ignoring cached documentation: %v\n", err)
+		}
 		return false
 	}
 
 	// TODO: Compare commit hash with current repo state
 	// TODO: Compare file versions
 
-	g.Meta = &meta
+	if meta.Language != g.Language {
+		logger.Printf("Cached documentation is in %s, regenerating in %s\n", languageLabel(meta.Language), languageLabel(g.Language))
+		return false
+	}
+
+	g.Meta = meta
 	return true
 }
 
-func (g *Generator) generateDocs(files map[string]*git.RepoFile) error {
-	// Read file contents
-	for path, _ := range files {
-		content, err := os.ReadFile(filepath.Join(g.RepoPath, path))
+func (g *Generator) generateDocs(ctx context.Context, files map[string]*git.RepoFile) error {
+	if err := g.loadFiles(files); err != nil {
+		return err
+	}
+
+	if g.SummaryDir != "" {
+		if err := g.summarizeFiles(ctx); err != nil {
+			return err
+		}
+	}
+	if err := g.fitFiles(g.sectionPrompts); err != nil {
+		return err
+	}
+
+	if err := g.generateSections(ctx); err != nil {
+		return err
+	}
+
+	sources := make(map[string]SectionSources)
+	for _, section := range g.Sections {
+		sources[section] = g.sectionSources(section)
+	}
+
+	if err := g.saveSources(sources); err != nil {
+		return err
+	}
+
+	return g.generateFullDoc()
+}
+
+// SectionSources records what a section's prompt embedded, so generated
+// claims can be traced back to source files
+type SectionSources struct {
+	Files     []string `json:"files"`               // files whose contents were embedded
+	Summaries []string `json:"summaries,omitempty"` // files embedded as cached summaries instead, in incremental mode
+}
+
+// sectionSources lists what sectionPrompt embeds for a section. The
+// changelog only names the files alongside the commit messages, so it has
+// no sources; the other sections embed every loaded file, or its summary.
+func (g *Generator) sectionSources(section string) SectionSources {
+	switch {
+	case section == ChangelogFileName:
+		return SectionSources{Files: []string{}}
+	case g.SummaryDir != "":
+		return SectionSources{Files: []string{}, Summaries: g.sortedFiles()}
+	}
+	return SectionSources{Files: g.sortedFiles()}
+}
+
+// saveSources writes each section's sources to SourcesFileName
+func (g *Generator) saveSources(sources map[string]SectionSources) error {
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sources: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(g.DocsPath, SourcesFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write sources: %w", fileError(err))
+	}
+	return nil
+}
+
+// generateSections writes each section file. With Parallel set, sections
+// are requested at once and the LLM client's limiter bounds how many run.
+// Each section is saved as soon as it succeeds and recorded as finished, and
+// sections an earlier failed run for the same commit and language recorded
+// are reused, so a rerun only regenerates what's missing.
+func (g *Generator) generateSections(ctx context.Context) error {
+	errs := make([]error, len(g.Sections))
+	var mu sync.Mutex
+	previous := g.loadProgress()
+	generate := func(i int, section string) {
+		if model, ok := previous[section]; ok && g.hasValidSection(section) {
+			logger.Printf("\nReusing %s from an earlier incomplete run\n", section)
+			mu.Lock()
+			g.setSectionModel(section, model)
+			mu.Unlock()
+			return
+		}
+
+		content, model, err := g.generateSection(ctx, section)
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", path, err)
+			errs[i] = fmt.Errorf("failed to generate section %s: %w", section, err)
+			return
+		}
+		if err := g.writeDoc(section, content); err != nil {
+			errs[i] = fmt.Errorf("failed to write section %s: %w", section, err)
+			return
+		}
+
+		// Flushed with each section, so an interrupted run loses only the
+		// sections still in flight
+		mu.Lock()
+		defer mu.Unlock()
+		g.setSectionModel(section, model)
+		if err := g.saveProgress(); err != nil {
+			logger.Warnf("%v\n", err)
 		}
-		g.Files[path] = string(content)
 	}
 
-	// Generate each section
-	sections := []string{OverviewFileName, GettingStartedFileName, UsageFileName}
-	for _, section := range sections {
-		content, err := g.generateSection(section)
+	if !g.Parallel || g.Stream != nil {
+		for i, section := range g.Sections {
+			if generate(i, section); errs[i] != nil {
+				return errs[i]
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i, section := range g.Sections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			generate(i, section)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// setSectionModel records the model that wrote a section
+func (g *Generator) setSectionModel(section, model string) {
+	if g.Meta.SectionModels == nil {
+		g.Meta.SectionModels = make(map[string]string)
+	}
+	g.Meta.SectionModels[section] = model
+}
+
+// generateSection returns the section content and the model that wrote it
+func (g *Generator) generateSection(ctx context.Context, section string) (string, string, error) {
+	prompt, err := g.sectionPrompt(section)
+	if err != nil {
+		return "", "", err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= g.SectionRetries; attempt++ {
+		if attempt == 0 {
+			logger.Printf("\nGenerating %s...\n", section)
+		} else {
+			logger.Printf("\nRetrying %s (attempt %d of %d): %v\n", section, attempt+1, g.SectionRetries+1, lastErr)
+		}
+
+		if g.Stream != nil {
+			fmt.Fprintf(g.Stream, "\n==================== %s ====================\n\n", section)
+		}
+
+		content, model, err := g.LLMClient.GenerateWithModel(ctx, systemPrompt, prompt, g.SectionTokens[section], g.Stream)
 		if err != nil {
-			return fmt.Errorf("failed to generate section %s: %w", section, err)
+			return "", "", err
+		}
+		if content, err = g.continueTruncated(ctx, section, prompt, content); err != nil {
+			return "", "", err
+		}
+		if g.Stream != nil {
+			fmt.Fprintln(g.Stream)
 		}
 
-		if err := os.WriteFile(filepath.Join(g.DocsPath, section), []byte(content), 0644); err != nil {
-			return fmt.Errorf("failed to write section %s: %w", section, err)
+		if lastErr = validateSection(content); lastErr == nil {
+			return content, model, nil
 		}
 	}
 
-	return g.generateFullDoc()
+	return "", "", fmt.Errorf("model returned invalid content after %d attempts: %w", g.SectionRetries+1, lastErr)
 }
 
-func (g *Generator) generateSection(section string) (string, error) {
+// hasValidSection reports whether a section an earlier run recorded as
+// finished is still on disk and usable. A file with no progress entry may
+// be from another commit or cut off mid-write, so it's never trusted.
+func (g *Generator) hasValidSection(section string) bool {
+	content, err := g.readDoc(section)
+	return err == nil && validateSection(content) == nil
+}
+
+// sectionPrompt assembles the full prompt for a section file. A profile or
+// meta-repo gets its own overview prompt, and a note ahead of the others.
+func (g *Generator) sectionPrompt(section string) (string, error) {
 	var prompt string
 	switch section {
 	case OverviewFileName:
+		if profileKind(g.RepoName) != "" {
+			return g.withInstructions(g.buildProfileOverviewPrompt()), nil
+		}
 		prompt = g.buildOverviewPrompt()
 	case GettingStartedFileName:
 		prompt = g.buildGettingStartedPrompt()
 	case UsageFileName:
 		prompt = g.buildUsagePrompt()
+		if g.CiteSource {
+			prompt += citationInstruction
+		}
+	case ChangelogFileName:
+		prompt = g.buildChangelogPrompt()
 	default:
 		return "", fmt.Errorf("unknown section: %s", section)
 	}
+	return g.withInstructions(g.profileNote() + prompt), nil
+}
+
+// continueTruncated asks the model to carry on when a section looks cut off
+// at the token limit, stitching the parts together.
+func (g *Generator) continueTruncated(ctx context.Context, section, prompt, content string) (string, error) {
+	continuations := 0
+	for continuations < maxContinuations && g.looksTruncated(section, content) {
+		continuePrompt := prompt + `
+
+Your previous response was cut off. Here is what you wrote so far:
 
-	fmt.Printf("\nGenerating %s...\n", section)
-	return g.LLMClient.GenerateWithStream(context.Background(), prompt)
+` + content + `
+
+Continue from where you left off. Do not repeat anything already written and do not add any preamble.`
+		if !g.promptFits(continuePrompt) {
+			logger.Warnf("%s looks truncated, but a continuation would exceed the context window; keeping it as is\n", section)
+			break
+		}
+
+		continuations++
+		logger.Printf("\n%s looks truncated, requesting continuation %d of %d...\n", section, continuations, maxContinuations)
+
+		more, _, err := g.LLMClient.GenerateWithModel(ctx, systemPrompt, continuePrompt, g.SectionTokens[section], g.Stream)
+		if err != nil {
+			return "", fmt.Errorf("failed to continue truncated section: %w", err)
+		}
+		content += more
+	}
+
+	if continuations > 0 {
+		logger.Printf("%s needed %d continuation(s)\n", section, continuations)
+	}
+	return content, nil
+}
+
+// looksTruncated guesses whether output stopped at the section's token
+// ceiling: either a code fence was left open, or the output is near the limit
+// and doesn't end with a newline.
+func (g *Generator) looksTruncated(section, content string) bool {
+	if strings.TrimSpace(content) == "" {
+		return false
+	}
+	if !fencesBalanced(content) {
+		return true
+	}
+	limit := g.sectionTokens(section)
+	nearLimit := limit > 0 && len(content)/bytesPerToken >= limit*9/10
+	return nearLimit && !strings.HasSuffix(content, "\n")
+}
+
+// validateSection rejects empty output and output with no markdown heading,
+// which usually means the model refused or apologised instead of answering.
+func validateSection(content string) error {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return fmt.Errorf("empty response")
+	}
+
+	for _, line := range strings.Split(trimmed, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return nil
+		}
+	}
+
+	snippet := trimmed
+	if len(snippet) > invalidSnippetLength {
+		snippet = snippet[:invalidSnippetLength] + "..."
+	}
+	return fmt.Errorf("response contains no markdown heading: %q", snippet)
 }
 
 func (g *Generator) generateFullDoc() error {
-	var fullDoc strings.Builder
+	fullDoc, err := g.joinSections()
+	if err != nil {
+		return err
+	}
+	if g.Meta != nil {
+		g.Meta.FullSections = g.fullSections()
+	}
+	return g.writeDoc(FullDocFileName, fullDoc)
+}
 
-	sections := []string{OverviewFileName, GettingStartedFileName, UsageFileName}
-	for _, section := range sections {
-		content, err := os.ReadFile(filepath.Join(g.DocsPath, section))
+// fullSections returns the generated sections that go into full.md
+func (g *Generator) fullSections() []string {
+	if g.FullSections == nil {
+		return g.Sections
+	}
+	// A section skipped at run time, like the changelog, is left out too
+	var sections []string
+	for _, section := range g.Sections {
+		if slices.Contains(g.FullSections, section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// joinSections concatenates the sections assembled into full.md, which is
+// what full.md holds before the cleanup pass
+func (g *Generator) joinSections() (string, error) {
+	var fullDoc strings.Builder
+	for _, section := range g.fullSections() {
+		content, err := g.readDoc(section)
 		if err != nil {
-			return fmt.Errorf("failed to read section %s: %w", section, err)
+			return "", fmt.Errorf("failed to read section %s: %w", section, err)
 		}
-		fullDoc.Write(content)
+		fullDoc.WriteString(content)
 		fullDoc.WriteString("\n\n")
 	}
-
-	return os.WriteFile(filepath.Join(g.DocsPath, FullDocFileName), []byte(fullDoc.String()), 0644)
+	return fullDoc.String(), nil
 }
 
 func (g *Generator) buildOverviewPrompt() string {
-	return fmt.Sprintf(`You are analyzing a software repository to create comprehensive documentation. 
-Based on the repository files provided below, create a detailed overview document in markdown format that includes:
+	return fmt.Sprintf(`Based on the repository files provided below, create a detailed overview document in markdown format that includes:
 
 1. A clear description of what the project does
 2. Key features and capabilities
@@ -167,11 +663,30 @@ Based on the repository files provided below, create a detailed overview documen
 Please ensure the output is well-formatted markdown with appropriate headers and sections.
 Use code examples from the files where relevant.
 
-Repository files:
+%s%sRepository structure:
 %s
-
 Contents:
-%s`, g.formatFileList(), g.formatFileContents())
+%s`, g.frameworkHint(), g.authorsHint(), g.formatFileTree(), g.formatFileContents())
+}
+
+// authorsHint lists who most recently worked on the key files, so the
+// overview can say who maintains what
+func (g *Generator) authorsHint() string {
+	if len(g.Authors) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(g.Authors))
+	for path := range g.Authors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	sb.WriteString("Primary authors of key files (most recent first, from git history; mention the main maintainers where it helps readers):\n")
+	for _, path := range paths {
+		fmt.Fprintf(&sb, "- %s: %s\n", path, strings.Join(g.Authors[path], ", "))
+	}
+	return sb.String() + "\n"
 }
 
 func (g *Generator) buildGettingStartedPrompt() string {
@@ -212,25 +727,125 @@ Contents:
 %s`, g.formatFileList(), g.formatFileContents())
 }
 
-func (g *Generator) formatFileList() string {
-	var files []string
-	for path := range g.Files {
-		files = append(files, path)
+// buildChangelogPrompt asks for a "What's new" summary of the recent commit
+// messages. File contents are left out: the commits are the subject, and the
+// file list is enough to relate them to the project's structure.
+func (g *Generator) buildChangelogPrompt() string {
+	return fmt.Sprintf(`Based on the recent commit history of a software repository provided below, write a "What's New" section in markdown that includes:
+
+1. A short summary of the overall direction of recent work
+2. Notable changes grouped by theme (e.g. features, fixes, performance, documentation, internal changes)
+3. Any breaking changes or deprecations users should know about
+
+Write for users of the project, not its maintainers: describe what changed and why it matters rather than listing every commit.
+Skip trivial commits such as typo fixes, merges and version bumps.
+Start with a "## What's New" heading.
+
+Repository files:
+%s
+
+Recent commits (newest first):
+%s`, g.formatFileList(), strings.Join(g.Commits, "\n\n"))
+}
+
+// withInstructions appends the user's extra instructions and the output
+// language to a prompt in delimited blocks, so they're applied the same way
+// by every prompt builder.
+func (g *Generator) withInstructions(prompt string) string {
+	if g.Instructions != "" {
+		prompt += "\n\n=== Additional instructions ===\n" + g.Instructions + "\n=== End of additional instructions ===\n"
 	}
-	sort.Strings(files)
-	return strings.Join(files, "\n")
+	return prompt + g.languageInstruction()
 }
 
-func (g *Generator) formatFileContents() string {
-	var result strings.Builder
+// loadFiles reads, cleans and redacts the selected files for the prompts.
+// A file that vanished since it was listed is skipped with a warning, unless
+// Strict, and a file that changed has its recorded size updated, so one
+// transient file in a working directory doesn't abort the run.
+func (g *Generator) loadFiles(files map[string]*git.RepoFile) error {
+	for path, file := range files {
+		content, err := os.ReadFile(filepath.Join(g.RepoPath, path))
+		if err != nil {
+			if err := logger.Problemf(g.Strict, "skipping %s: %v\n", path, err); err != nil {
+				return err
+			}
+			continue
+		}
+		text := string(content)
+		if git.IsNotebook(path) {
+			if source, err := git.NotebookSource(content); err == nil {
+				text = source
+			}
+		}
+		if g.StripComments {
+			text = git.StripComments(path, text)
+		}
+		// A truncated file was listed at TruncateSize, not its final size
+		if short, ok := git.TruncateContent(text, g.TruncateSize); ok {
+			if g.truncated == nil {
+				g.truncated = make(map[string]int)
+			}
+			g.truncated[path] = len(text)
+			text = short
+		} else if size := int64(len(text)); file != nil && size != file.Size {
+			logger.Verbosef("%s changed size since it was listed (%d -> %d bytes)\n", path, file.Size, size)
+			file.Size = size
+		}
+		g.Files[path] = cleanDocInput(path, text)
+	}
+	if len(files) > 0 && len(g.Files) == 0 {
+		return fmt.Errorf("none of the %d selected files could be read", len(files))
+	}
+	g.redactFiles()
+	g.frameworks = detectFrameworks(g.RepoPath)
+	return nil
+}
+
+// sortedFiles returns the paths of all loaded files in sorted order
+func (g *Generator) sortedFiles() []string {
 	files := make([]string, 0, len(g.Files))
 	for path := range g.Files {
 		files = append(files, path)
 	}
 	sort.Strings(files)
+	return files
+}
+
+func (g *Generator) formatFileList() string {
+	return strings.Join(g.sortedFiles(), "\n")
+}
+
+func (g *Generator) formatFileTree() string {
+	if len(g.Binaries) == 0 {
+		return renderTree(g.sortedFiles(), nil, maxTreeDepth, maxTreeEntries)
+	}
+
+	paths := g.sortedFiles()
+	labels := make(map[string]string, len(g.Binaries))
+	for path, size := range g.Binaries {
+		paths = append(paths, path)
+		labels[path] = fmt.Sprintf("(binary, %d bytes)", size)
+	}
+	return renderTree(paths, labels, maxTreeDepth, maxTreeEntries) +
+		"Binary files are listed by name and size only; their contents are not included.\n"
+}
 
-	for _, path := range files {
-		result.WriteString(fmt.Sprintf("\n=== %s ===\n", path))
+func (g *Generator) formatFileContents() string {
+	header := "\n=== %s ===\n"
+	if g.SummaryDir != "" {
+		header = "\n=== %s (summary) ===\n"
+	}
+
+	var result strings.Builder
+	for _, path := range g.sortedFiles() {
+		result.WriteString(fmt.Sprintf(header, path))
+		if copies := g.Identical[path]; len(copies) > 0 {
+			result.WriteString(fmt.Sprintf("(these %d paths are identical, shown once: %s)\n",
+				len(copies)+1, strings.Join(append([]string{path}, copies...), ", ")))
+		}
+		if size, ok := g.truncated[path]; ok {
+			result.WriteString(fmt.Sprintf("(truncated from %d bytes: only the first and last lines are shown)\n", size))
+		}
 		result.WriteString(g.Files[path])
 		result.WriteString("\n")
 	}
@@ -238,90 +853,260 @@ func (g *Generator) formatFileContents() string {
 }
 
 func (g *Generator) loadFromCache() error {
-	sections := []string{OverviewFileName, GettingStartedFileName, UsageFileName, FullDocFileName}
+	if err := g.restoreUnprocessed(); err != nil {
+		return err
+	}
+
+	sections := append(append([]string{}, g.Sections...), FullDocFileName)
 
-	var fullDoc strings.Builder
 	for _, section := range sections {
-		content, err := os.ReadFile(filepath.Join(g.DocsPath, section))
+		content, err := g.readDoc(section)
 		if err != nil {
 			return fmt.Errorf("failed to read cached section %s: %w", section, err)
 		}
-		if section != FullDocFileName {
-			fullDoc.Write(content)
-			fullDoc.WriteString("\n\n")
+		// Rewrite so frontmatter follows the current --frontmatter setting
+		if err := g.writeDoc(section, content); err != nil {
+			return fmt.Errorf("failed to write cached section %s: %w", section, err)
 		}
 	}
 
-	fmt.Println("Documentation loaded from cache.")
-	fmt.Printf("\nGenerated with: %s\n", g.Meta.ModelUsed)
-	fmt.Printf("Commit: %s\n", g.Meta.CommitHash)
-	fmt.Printf("Generated at: %s\n", g.Meta.GeneratedAt.Format(time.RFC3339))
+	if err := g.reassembleFullDoc(); err != nil {
+		return err
+	}
+
+	logger.Println("Documentation loaded from cache.")
+	logger.Printf("\nGenerated with: %s\n", g.Meta.ModelUsed)
+	logger.Printf("Commit: %s\n", g.Meta.CommitHash)
+	logger.Printf("Generated at: %s\n", g.Meta.GeneratedAt.Format(time.RFC3339))
 
 	return nil
 }
 
-func (g *Generator) CleanupDuplicates() error {
-	// Check if already deduplicated
-	if g.Meta.Deduplicated {
-		fmt.Println("Documentation already deduplicated, skipping cleanup pass...")
+// reassembleFullDoc rebuilds a cached full.md that was assembled from
+// different sections than are now asked for. The new full.md hasn't been
+// cleaned, so the cleanup pass runs again.
+func (g *Generator) reassembleFullDoc() error {
+	cached := g.Meta.FullSections
+	if cached == nil {
+		// Metadata from before full_sections was recorded
+		cached = g.Sections
+	}
+	if slices.Equal(cached, g.fullSections()) {
 		return nil
 	}
 
-	fullDocPath := filepath.Join(g.DocsPath, FullDocFileName)
-	content, err := os.ReadFile(fullDocPath)
-	if err != nil {
-		return fmt.Errorf("failed to read full documentation: %w", err)
+	logger.Printf("Reassembling %s from %s\n", FullDocFileName, strings.Join(g.fullSections(), ", "))
+	if err := g.generateFullDoc(); err != nil {
+		return err
 	}
+	g.Meta.Deduplicated = false
+	g.Meta.DedupMethod = ""
+	g.Meta.DedupHash = ""
+	return g.saveMetadata()
+}
 
-	prompt := `You are cleaning up a combined markdown documentation file. 
-The content is currently duplicated across Overview, Getting Started, and Usage sections.
+// cleanupPrompt introduces the combined documentation for the cleanup pass,
+// naming the sections full.md was assembled from. A changelog is kept apart:
+// recent changes belong in their own section, not folded into the others.
+func (g *Generator) cleanupPrompt() string {
+	var titles, merged []string
+	changelog := false
+	for _, section := range g.fullSections() {
+		titles = append(titles, sectionTitles[section])
+		if section == ChangelogFileName {
+			changelog = true
+			continue
+		}
+		merged = append(merged, sectionTitles[section])
+	}
 
-Please:
+	var sb strings.Builder
+	sb.WriteString("Clean up the combined markdown documentation file below.\n")
+	switch len(merged) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&sb, "The %s section may repeat itself.\n\n", merged[0])
+	default:
+		fmt.Fprintf(&sb, "The content is currently duplicated across the %s and %s sections.\n\n",
+			strings.Join(merged[:len(merged)-1], ", "), merged[len(merged)-1])
+	}
+	sb.WriteString(`Please:
 1. Keep only ONE top-level title
 2. Consolidate similar sections (e.g. combine all installation instructions into one section)
 3. Remove duplicate explanations while keeping the most detailed version
-4. Maintain a clear, logical flow from overview -> setup -> basic usage -> advanced usage
-5. Preserve ALL unique examples, especially in the advanced usage section
+4. Maintain a clear, logical flow that follows the order of the original sections
+5. Preserve ALL unique examples
 6. Keep ALL technical information and details
 7. Ensure section headers follow a logical hierarchy
+`)
+	if changelog {
+		fmt.Fprintf(&sb, "8. Keep the %s section separate, as it is: don't merge recent changes into the other sections or move their content into it\n", sectionTitles[ChangelogFileName])
+	}
 
-Original sections to combine:
-1. Overview & Features (#)
-2. Getting Started (##)
-3. Usage Guide (##)
-
+	sb.WriteString("\nOriginal sections, in order:\n")
+	for i, title := range titles {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, title)
+	}
+	sb.WriteString(`
 Please output a single, well-structured markdown document with no duplicate information.
 Keep the most comprehensive version of any duplicated content.
 
 Content to clean up:
-` + string(content)
+`)
+	return sb.String()
+}
+
+// CleanupDuplicates merges the repeated material in full.md, once per
+// commit. Rerunning it on cleaned docs is a no-op, even if the metadata
+// recording the cleanup was lost.
+func (g *Generator) CleanupDuplicates(ctx context.Context) error {
+	if g.alreadyDeduplicated() {
+		logger.Println("Documentation already deduplicated, skipping cleanup pass...")
+		return nil
+	}
+	if g.Meta == nil {
+		return fmt.Errorf("failed to clean documentation: no metadata for %s", g.DocsPath)
+	}
+
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read full documentation: %w", err)
+	}
 
-	fmt.Println("\nPerforming final cleanup pass to remove duplicates...")
-	cleaned, err := g.LLMClient.GenerateWithStream(context.Background(), prompt)
+	prompt := g.withInstructions(g.cleanupPrompt() + content)
+
+	// Small docs don't justify another model call, and docs too big to fit
+	// the context window can't have one; drop repeated blocks locally
+	fits := g.promptFits(prompt)
+	if !fits {
+		logger.Printf("\nDocumentation is too large for a cleanup pass within the %d token context window\n", g.ContextWindow)
+	}
+	if len(content) < g.DedupThreshold || !fits {
+		logger.Println("\nRemoving duplicate paragraphs locally...")
+		return g.saveCleaned(dedupLocally(content), DedupMethodLocal)
+	}
+
+	logger.Println("\nPerforming final cleanup pass to remove duplicates...")
+	cleaned, err := g.LLMClient.GenerateWithStream(ctx, systemPrompt, prompt, nil)
 	if err != nil {
 		return fmt.Errorf("failed to clean documentation: %w", err)
 	}
 
-	// Save the cleaned version
-	if err := os.WriteFile(fullDocPath, []byte(cleaned), 0644); err != nil {
-		return fmt.Errorf("failed to write cleaned documentation: %w", err)
+	// Keep the uncleaned concatenation rather than lose or mangle examples.
+	// Metadata stays un-deduplicated so a later run can try again.
+	if err := checkCodePreserved(content, cleaned); err != nil {
+		logger.Warnf("Discarding cleanup result (%v), keeping original documentation\n", err)
+		return nil
 	}
 
-	// Update and save metadata
+	return g.saveCleaned(cleaned, DedupMethodLLM)
+}
+
+// saveCleaned records the cleanup in the metadata, with a hash of the
+// cleaned text, before writing it to full.md. A run stopped between the two
+// leaves a hash full.md doesn't match, so the next run cleans again rather
+// than mistaking the raw concatenation for cleaned text, and cleaned text
+// is never cleaned twice.
+func (g *Generator) saveCleaned(cleaned, method string) error {
 	g.Meta.Deduplicated = true
+	g.Meta.DedupMethod = method
+	g.Meta.DedupHash = docHash(cleaned)
+	if err := g.saveMetadata(); err != nil {
+		return err
+	}
+	if err := g.writeDoc(FullDocFileName, cleaned); err != nil {
+		return fmt.Errorf("failed to write cleaned documentation: %w", err)
+	}
+	return nil
+}
+
+// docHash identifies a document's text, ignoring its frontmatter, tags
+// footer and surrounding whitespace, which are rewritten independently
+func docHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(stripTagsFooter(stripFrontmatter(content)))))
+	return hex.EncodeToString(sum[:])
+}
+
+// SkipCleanup is used instead of CleanupDuplicates when the cleanup pass is
+// turned off: full.md is left as the raw concatenation of the sections,
+// restoring it if cached docs were cleaned by an earlier run.
+func (g *Generator) SkipCleanup() error {
+	if !g.Meta.Deduplicated {
+		return nil
+	}
+
+	logger.Println("Restoring the uncleaned documentation...")
+	if err := g.generateFullDoc(); err != nil {
+		return err
+	}
+	g.Meta.Deduplicated = false
+	g.Meta.DedupMethod = ""
+	g.Meta.DedupHash = ""
 	return g.saveMetadata()
 }
 
+// alreadyDeduplicated reports whether cleanup has run for this commit. The
+// metadata on disk is checked too, since g.Meta may have been built fresh by
+// the caller rather than loaded from the cache.
+func (g *Generator) alreadyDeduplicated() bool {
+	if g.Meta == nil || !g.Meta.Deduplicated {
+		saved, err := LoadMetadata(g.DocsPath)
+		if err != nil || !saved.Deduplicated {
+			return false
+		}
+		switch {
+		case g.Meta == nil:
+			g.Meta = saved
+		case saved.CommitHash != g.Meta.CommitHash:
+			return false
+		default:
+			g.Meta.Deduplicated = true
+			g.Meta.DedupMethod = saved.DedupMethod
+			g.Meta.DedupHash = saved.DedupHash
+		}
+	}
+	return g.cleanedDocWritten()
+}
+
+// cleanedDocWritten reports whether full.md holds the text the recorded
+// cleanup produced. Metadata saved before hashes were recorded is trusted.
+func (g *Generator) cleanedDocWritten() bool {
+	if g.Meta.DedupHash == "" {
+		return true
+	}
+	if content, err := g.readDoc(FullDocFileName); err == nil && docHash(content) == g.Meta.DedupHash {
+		return true
+	}
+	logger.Verbosef("%s doesn't match its recorded cleanup, cleaning it again\n", FullDocFileName)
+	g.Meta.Deduplicated = false
+	g.Meta.DedupMethod = ""
+	g.Meta.DedupHash = ""
+	return false
+}
+
 // Helper function to save metadata
 func (g *Generator) saveMetadata() error {
+	g.Meta.SchemaVersion = MetadataSchemaVersion
 	metaData, err := json.MarshalIndent(g.Meta, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
 	if err := os.WriteFile(filepath.Join(g.DocsPath, MetadataFileName), metaData, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata: %w", err)
+		return fmt.Errorf("failed to write metadata: %w", fileError(err))
 	}
 
 	return nil
 }
+
+// DiscardCache removes generated docs and their metadata, so the next
+// LoadOrGenerateDocs generates afresh instead of loading or reusing them
+func (g *Generator) DiscardCache() error {
+	names := append(append([]string{}, sectionOrder...), FullDocFileName, SummaryFileName, SourcesFileName, UnprocessedFileName, ManifestFileName, ProgressFileName, MetadataFileName)
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(g.DocsPath, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove cached %s: %w", name, fileError(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package docs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cleanupClient is an LLMClient that "cleans" documentation by dropping its
+// second half, counting how often it's asked
+type cleanupClient struct {
+	calls int
+}
+
+func (c *cleanupClient) GenerateWithStream(ctx context.Context, system, prompt string, stream io.Writer) (string, error) {
+	c.calls++
+	_, content, _ := strings.Cut(prompt, "Content to clean up:\n")
+	return content[:strings.Index(content, "# Getting Started")], nil
+}
+
+func (c *cleanupClient) GenerateWithModel(ctx context.Context, system, prompt string, maxTokens int, stream io.Writer) (string, string, error) {
+	completion, err := c.GenerateWithStream(ctx, system, prompt, stream)
+	return completion, "test-model", err
+}
+
+const rawFullDoc = "# Overview\n\nIt parses things.\n\n# Getting Started\n\nIt parses things.\n"
+
+func newCleanupGenerator(t *testing.T, dir string, client LLMClient) *Generator {
+	t.Helper()
+	return &Generator{
+		DocsPath:  dir,
+		LLMClient: client,
+		Meta:      &Metadata{CommitHash: "abc123"},
+	}
+}
+
+func readFullDoc(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, FullDocFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCleanupDuplicatesIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FullDocFileName), []byte(rawFullDoc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := &cleanupClient{}
+	ctx := context.Background()
+
+	if err := newCleanupGenerator(t, dir, client).CleanupDuplicates(ctx); err != nil {
+		t.Fatalf("first cleanup: %v", err)
+	}
+	cleaned := readFullDoc(t, dir)
+	if client.calls != 1 || strings.Contains(cleaned, "Getting Started") {
+		t.Fatalf("first cleanup made %d calls and left %q", client.calls, cleaned)
+	}
+	meta, err := LoadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Deduplicated || meta.DedupHash != docHash(cleaned) {
+		t.Fatalf("metadata = %+v, want deduplicated with the cleaned text's hash", meta)
+	}
+
+	// A second run, with metadata built fresh as the caller does, changes
+	// nothing and doesn't call the model
+	if err := newCleanupGenerator(t, dir, client).CleanupDuplicates(ctx); err != nil {
+		t.Fatalf("second cleanup: %v", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("second cleanup called the model; %d calls in total", client.calls)
+	}
+	if got := readFullDoc(t, dir); got != cleaned {
+		t.Errorf("second cleanup changed full.md to %q", got)
+	}
+}
+
+func TestCleanupDuplicatesAfterInterruptedWrite(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FullDocFileName), []byte(rawFullDoc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := &cleanupClient{}
+	ctx := context.Background()
+	if err := newCleanupGenerator(t, dir, client).CleanupDuplicates(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata is saved but the run stopped before full.md was written
+	if err := os.WriteFile(filepath.Join(dir, FullDocFileName), []byte(rawFullDoc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newCleanupGenerator(t, dir, client).CleanupDuplicates(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.calls != 2 {
+		t.Errorf("raw full.md wasn't cleaned again; %d calls in total", client.calls)
+	}
+	if got := readFullDoc(t, dir); strings.Contains(got, "Getting Started") {
+		t.Errorf("full.md still raw: %q", got)
+	}
+}
+
+func TestCleanupDuplicatesTrustsMetadataWithoutHash(t *testing.T) {
+	dir := t.TempDir()
+	g := newCleanupGenerator(t, dir, &cleanupClient{})
+	g.Meta.Deduplicated = true
+	if !g.alreadyDeduplicated() {
+		t.Error("metadata from before hashes were recorded wasn't trusted")
+	}
+}
+
+func TestProgressOnlyCountsForSameCommitAndLanguage(t *testing.T) {
+	dir := t.TempDir()
+	saved := &Generator{DocsPath: dir, Meta: &Metadata{
+		CommitHash:    "abc123",
+		Language:      "fr",
+		SectionModels: map[string]string{OverviewFileName: "test-model"},
+	}}
+	if err := saved.saveProgress(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		commit   string
+		language string
+		want     bool
+	}{
+		{"same run", "abc123", "fr", true},
+		{"other commit", "def456", "fr", false},
+		{"other language", "abc123", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{DocsPath: dir, Meta: &Metadata{CommitHash: tt.commit, Language: tt.language}}
+			model, ok := g.loadProgress()[OverviewFileName]
+			if ok != tt.want {
+				t.Fatalf("overview recorded = %v, want %v", ok, tt.want)
+			}
+			if ok && model != "test-model" {
+				t.Errorf("model = %q, want test-model", model)
+			}
+		})
+	}
+}
+
+func TestSectionSources(t *testing.T) {
+	g := &Generator{Files: map[string]string{"b.go": "b", "a.go": "a"}}
+	tests := []struct {
+		name       string
+		summaryDir string
+		section    string
+		want       SectionSources
+	}{
+		{"usage", "", UsageFileName, SectionSources{Files: []string{"a.go", "b.go"}}},
+		{"changelog", "", ChangelogFileName, SectionSources{Files: []string{}}},
+		{"incremental overview", "summaries", OverviewFileName, SectionSources{Files: []string{}, Summaries: []string{"a.go", "b.go"}}},
+		{"incremental changelog", "summaries", ChangelogFileName, SectionSources{Files: []string{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.SummaryDir = tt.summaryDir
+			if got := g.sectionSources(tt.section); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sectionSources(%s) = %+v, want %+v", tt.section, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanupPromptNamesSections(t *testing.T) {
+	g := &Generator{Sections: []string{OverviewFileName, UsageFileName, ChangelogFileName}}
+	prompt := g.cleanupPrompt()
+	if !strings.Contains(prompt, "duplicated across the Overview and Usage sections") {
+		t.Errorf("prompt doesn't name the merged sections:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "Getting Started") {
+		t.Errorf("prompt names a section that wasn't generated:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Keep the What's New section separate") {
+		t.Errorf("prompt doesn't keep the changelog separate:\n%s", prompt)
+	}
+
+	g.Sections = DefaultSections
+	if prompt := g.cleanupPrompt(); !strings.Contains(prompt, "Overview, Getting Started and Usage sections") {
+		t.Errorf("prompt doesn't name the default sections:\n%s", prompt)
+	}
+	if prompt := g.cleanupPrompt(); strings.Contains(prompt, "What's New") {
+		t.Errorf("prompt mentions a changelog that wasn't generated:\n%s", prompt)
+	}
+}
@@ -0,0 +1,24 @@
+package docs
+
+// FileError is a failure reading or writing files in the docs directory,
+// so callers can tell it apart from a failed model call that happened in
+// the same step
+type FileError struct {
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// fileError tags err from a filesystem call as a *FileError
+func fileError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FileError{Err: err}
+}
@@ -0,0 +1,112 @@
+package docs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/internal/selector"
+)
+
+// estimateTokens converts a prompt's length to tokens with the same rough
+// bytesPerToken ratio used everywhere else
+func estimateTokens(text string) int {
+	return (len(text) + bytesPerToken - 1) / bytesPerToken
+}
+
+// promptFits reports whether prompt, with the system message and room for a
+// full completion, fits the model's context window. Without a known window
+// every prompt fits.
+func (g *Generator) promptFits(prompt string) bool {
+	return g.ContextWindow <= 0 || estimateTokens(systemPrompt+prompt)+g.completionTokens() <= g.ContextWindow
+}
+
+// sectionTokens returns the completion token limit for a section
+func (g *Generator) sectionTokens(section string) int {
+	if tokens, ok := g.SectionTokens[section]; ok {
+		return tokens
+	}
+	return g.MaxTokens
+}
+
+// completionTokens is the largest completion any section may produce, the
+// room every prompt has to leave in the context window
+func (g *Generator) completionTokens() int {
+	tokens := g.MaxTokens
+	for _, t := range g.SectionTokens {
+		tokens = max(tokens, t)
+	}
+	return tokens
+}
+
+// fitFiles drops the lowest-priority files until every prompt from build
+// fits the context window, so a prompt the API is bound to reject is never
+// sent. Each dropped file is logged.
+func (g *Generator) fitFiles(build func() ([]string, error)) error {
+	if g.ContextWindow <= 0 {
+		return nil
+	}
+
+	for {
+		prompts, err := build()
+		if err != nil {
+			return err
+		}
+		largest := 0
+		for _, prompt := range prompts {
+			largest = max(largest, estimateTokens(systemPrompt+prompt))
+		}
+		over := largest + g.completionTokens() - g.ContextWindow
+		if over <= 0 {
+			return nil
+		}
+		if len(g.Files) <= 1 {
+			return fmt.Errorf("prompt of ~%d tokens exceeds the %d token context window even with a single file; lower --max-size",
+				largest, g.ContextWindow)
+		}
+
+		// Drop enough files to cover the overflow, then measure again since
+		// headers and notes shrink too
+		freed := 0
+		for _, path := range g.trimOrder() {
+			if freed >= over*bytesPerToken || len(g.Files) <= 1 {
+				break
+			}
+			size := len(g.Files[path])
+			delete(g.Files, path)
+			freed += size
+			logger.Warnf("trimmed %s (%d bytes) from the prompts to fit the %d token context window\n", path, size, g.ContextWindow)
+		}
+	}
+}
+
+// trimOrder returns the loaded files from least to most important, larger
+// files first among equals so fewer need to go
+func (g *Generator) trimOrder() []string {
+	paths := g.sortedFiles()
+	scores := make(map[string]int, len(paths))
+	for _, path := range paths {
+		scores[path] = selector.Score(path, int64(len(g.Files[path])))
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, b := paths[i], paths[j]
+		if scores[a] != scores[b] {
+			return scores[a] < scores[b]
+		}
+		return len(g.Files[a]) > len(g.Files[b])
+	})
+	return paths
+}
+
+// sectionPrompts builds every section's prompt, for fitFiles
+func (g *Generator) sectionPrompts() ([]string, error) {
+	prompts := make([]string, 0, len(g.Sections))
+	for _, section := range g.Sections {
+		prompt, err := g.sectionPrompt(section)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, nil
+}
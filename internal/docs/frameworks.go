@@ -0,0 +1,115 @@
+package docs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// frameworkRule recognizes a framework from a dependency in a manifest, or
+// from a file characteristic of it when pattern is nil.
+type frameworkRule struct {
+	name    string
+	file    string
+	pattern *regexp.Regexp
+}
+
+// jsDep matches a package.json or composer.json dependency key
+func jsDep(name string) *regexp.Regexp {
+	return regexp.MustCompile(`"` + regexp.QuoteMeta(name) + `"\s*:`)
+}
+
+// pyDep matches a requirement in requirements.txt, pyproject.toml or a Gemfile
+func pyDep(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?im)(^|["'\s])` + regexp.QuoteMeta(name) + `([\s=<>~!\[;,"']|$)`)
+}
+
+// contains matches a literal module path or artifact name
+func contains(s string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(s))
+}
+
+var frameworkRules = []frameworkRule{
+	{"Gin", "go.mod", contains("github.com/gin-gonic/gin")},
+	{"Echo", "go.mod", contains("github.com/labstack/echo")},
+	{"Fiber", "go.mod", contains("github.com/gofiber/fiber")},
+	{"chi", "go.mod", contains("github.com/go-chi/chi")},
+	{"Gorilla mux", "go.mod", contains("github.com/gorilla/mux")},
+	{"Cobra", "go.mod", contains("github.com/spf13/cobra")},
+
+	{"Next.js", "package.json", jsDep("next")},
+	{"React", "package.json", jsDep("react")},
+	{"Vue", "package.json", jsDep("vue")},
+	{"Nuxt", "package.json", jsDep("nuxt")},
+	{"Angular", "package.json", jsDep("@angular/core")},
+	{"Svelte", "package.json", jsDep("svelte")},
+	{"NestJS", "package.json", jsDep("@nestjs/core")},
+	{"Express", "package.json", jsDep("express")},
+
+	{"Django", "requirements.txt", pyDep("django")},
+	{"Flask", "requirements.txt", pyDep("flask")},
+	{"FastAPI", "requirements.txt", pyDep("fastapi")},
+	{"Django", "pyproject.toml", pyDep("django")},
+	{"Flask", "pyproject.toml", pyDep("flask")},
+	{"FastAPI", "pyproject.toml", pyDep("fastapi")},
+
+	{"Rails", "Gemfile", pyDep("rails")},
+	{"Sinatra", "Gemfile", pyDep("sinatra")},
+
+	{"Actix Web", "Cargo.toml", pyDep("actix-web")},
+	{"Axum", "Cargo.toml", pyDep("axum")},
+	{"Rocket", "Cargo.toml", pyDep("rocket")},
+
+	{"Laravel", "composer.json", jsDep("laravel/framework")},
+	{"Symfony", "composer.json", contains(`"symfony/framework-bundle"`)},
+
+	{"Spring Boot", "pom.xml", contains("spring-boot")},
+	{"Spring Boot", "build.gradle", contains("spring-boot")},
+
+	{"Django", "manage.py", nil},
+	{"Next.js", "next.config.js", nil},
+	{"Next.js", "next.config.mjs", nil},
+	{"Angular", "angular.json", nil},
+	{"Laravel", "artisan", nil},
+}
+
+// detectFrameworks applies frameworkRules to the manifests and marker files
+// at the root of repoPath, returning framework names in rule order.
+func detectFrameworks(repoPath string) []string {
+	contents := make(map[string]string)
+	present := make(map[string]bool)
+	found := make(map[string]bool)
+	var names []string
+
+	for _, rule := range frameworkRules {
+		if found[rule.name] {
+			continue
+		}
+
+		if _, read := present[rule.file]; !read {
+			data, err := os.ReadFile(filepath.Join(repoPath, rule.file))
+			present[rule.file] = err == nil
+			contents[rule.file] = string(data)
+		}
+		if !present[rule.file] {
+			continue
+		}
+
+		if rule.pattern == nil || rule.pattern.MatchString(contents[rule.file]) {
+			found[rule.name] = true
+			names = append(names, rule.name)
+		}
+	}
+	return names
+}
+
+// frameworkHint tells the model which frameworks were detected, so it
+// doesn't guess from the code alone.
+func (g *Generator) frameworkHint() string {
+	if len(g.frameworks) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Detected framework: %s\n\n", strings.Join(g.frameworks, ", "))
+}
@@ -0,0 +1,99 @@
+package docs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sectionTitles are the frontmatter titles for each section file
+var sectionTitles = map[string]string{
+	OverviewFileName:       "Overview",
+	GettingStartedFileName: "Getting Started",
+	UsageFileName:          "Usage",
+	ChangelogFileName:      "What's New",
+	FullDocFileName:        "Documentation",
+	SummaryFileName:        "Summary",
+}
+
+type frontmatter struct {
+	Title  string    `yaml:"title"`
+	Weight int       `yaml:"weight,omitempty"`
+	Repo   string    `yaml:"repo,omitempty"`
+	Commit string    `yaml:"commit,omitempty"`
+	Date   time.Time `yaml:"date"`
+	Tags   []string  `yaml:"tags,omitempty"`
+}
+
+// stripFrontmatter removes a leading YAML frontmatter block, if any
+func stripFrontmatter(content string) string {
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		return content
+	}
+	if strings.HasPrefix(rest, "---\n") {
+		return strings.TrimLeft(rest[len("---\n"):], "\n")
+	}
+	if idx := strings.Index(rest, "\n---\n"); idx != -1 {
+		return strings.TrimLeft(rest[idx+len("\n---\n"):], "\n")
+	}
+	return content
+}
+
+// frontmatterFor renders the frontmatter block for a doc file. Sections are
+// weighted by document order so static site generators list them correctly.
+func (g *Generator) frontmatterFor(name string) (string, error) {
+	fm := frontmatter{
+		Title: sectionTitles[name],
+		Repo:  g.RepoName,
+	}
+	for i, section := range sectionOrder {
+		if section == name {
+			fm.Weight = i + 1
+		}
+	}
+	if g.Meta != nil {
+		fm.Commit = g.Meta.CommitHash
+		fm.Date = g.Meta.GeneratedAt
+		if name == FullDocFileName {
+			fm.Tags = g.Meta.Tags
+		}
+	}
+
+	data, err := yaml.Marshal(fm)
+	if err != nil {
+		return "", fmt.Errorf("failed to render frontmatter: %w", err)
+	}
+	return "---\n" + string(data) + "---\n\n", nil
+}
+
+// writeDoc writes a section or full.md, adding frontmatter when enabled.
+// Any frontmatter or tags footer already in content is replaced; without
+// frontmatter, full.md lists its tags in a footer instead.
+func (g *Generator) writeDoc(name, content string) error {
+	content = stripTagsFooter(stripFrontmatter(content))
+	if !g.Frontmatter && name == FullDocFileName && g.Meta != nil && len(g.Meta.Tags) > 0 {
+		content += tagsFooter(g.Meta.Tags)
+	}
+	if g.Frontmatter {
+		fm, err := g.frontmatterFor(name)
+		if err != nil {
+			return err
+		}
+		content = fm + content
+	}
+	return fileError(os.WriteFile(filepath.Join(g.DocsPath, name), []byte(content), 0644))
+}
+
+// readDoc reads a section or full.md without its frontmatter or tags footer
+func (g *Generator) readDoc(name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(g.DocsPath, name))
+	if err != nil {
+		return "", fileError(err)
+	}
+	return stripTagsFooter(stripFrontmatter(string(content))), nil
+}
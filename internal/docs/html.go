@@ -0,0 +1,208 @@
+package docs
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingLine  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletLine   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	numberedLine = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	ruleLine     = regexp.MustCompile(`^(-\s*){3,}$|^(\*\s*){3,}$|^(_\s*){3,}$`)
+	tableDivider = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+	linkSpan   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongSpan = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emSpan     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+)
+
+// RenderHTML converts generated markdown to an HTML fragment. It covers what
+// the prompts produce: headings, paragraphs, lists, fenced code, tables,
+// block quotes, rules, and inline code, links and emphasis. Frontmatter and
+// the tags footer are dropped.
+func RenderHTML(markdown string) string {
+	r := &htmlRenderer{}
+	lines := strings.Split(stripTagsFooter(stripFrontmatter(markdown)), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if r.inCode {
+			if isFence(line) {
+				r.out.WriteString("</code></pre>\n")
+				r.inCode = false
+			} else {
+				r.out.WriteString(html.EscapeString(line) + "\n")
+			}
+			continue
+		}
+
+		switch {
+		case isFence(line):
+			r.closeBlocks()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			if lang != "" {
+				fmt.Fprintf(&r.out, "<pre><code class=\"language-%s\">", html.EscapeString(lang))
+			} else {
+				r.out.WriteString("<pre><code>")
+			}
+			r.inCode = true
+		case trimmed == "":
+			r.closeBlocks()
+		case headingLine.MatchString(trimmed):
+			r.closeBlocks()
+			m := headingLine.FindStringSubmatch(trimmed)
+			fmt.Fprintf(&r.out, "<h%d>%s</h%d>\n", len(m[1]), renderInline(m[2]), len(m[1]))
+		case ruleLine.MatchString(trimmed):
+			r.closeBlocks()
+			r.out.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, "|"):
+			r.closeBlocks()
+			start := i
+			for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "|") {
+				i++
+			}
+			r.table(lines[start : i+1])
+		case bulletLine.MatchString(line):
+			r.listItem("ul", bulletLine.FindStringSubmatch(line)[1])
+		case numberedLine.MatchString(line):
+			r.listItem("ol", numberedLine.FindStringSubmatch(line)[1])
+		case strings.HasPrefix(trimmed, ">"):
+			r.closeBlocks()
+			fmt.Fprintf(&r.out, "<blockquote><p>%s</p></blockquote>\n", renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+		case r.list != "" && line != trimmed:
+			// An indented continuation of the previous list item
+			r.out.WriteString(" " + renderInline(trimmed))
+		default:
+			r.closeList()
+			r.para = append(r.para, trimmed)
+		}
+	}
+
+	if r.inCode {
+		r.out.WriteString("</code></pre>\n")
+	}
+	r.closeBlocks()
+	return r.out.String()
+}
+
+type htmlRenderer struct {
+	out    strings.Builder
+	para   []string
+	list   string // "ul" or "ol" while a list is open
+	inCode bool
+}
+
+func (r *htmlRenderer) closeBlocks() {
+	r.closeParagraph()
+	r.closeList()
+}
+
+func (r *htmlRenderer) closeParagraph() {
+	if len(r.para) == 0 {
+		return
+	}
+	fmt.Fprintf(&r.out, "<p>%s</p>\n", renderInline(strings.Join(r.para, " ")))
+	r.para = nil
+}
+
+func (r *htmlRenderer) closeList() {
+	if r.list == "" {
+		return
+	}
+	fmt.Fprintf(&r.out, "</li>\n</%s>\n", r.list)
+	r.list = ""
+}
+
+func (r *htmlRenderer) listItem(kind, text string) {
+	r.closeParagraph()
+	switch r.list {
+	case kind:
+		r.out.WriteString("</li>\n")
+	case "":
+		fmt.Fprintf(&r.out, "<%s>\n", kind)
+	default:
+		r.closeList()
+		fmt.Fprintf(&r.out, "<%s>\n", kind)
+	}
+	r.list = kind
+	r.out.WriteString("<li>" + renderInline(text))
+}
+
+// table renders a pipe table; the row after the header is the divider
+func (r *htmlRenderer) table(rows []string) {
+	r.out.WriteString("<table>\n")
+	for i, row := range rows {
+		if i == 1 && tableDivider.MatchString(row) {
+			continue
+		}
+		cell := "td"
+		if i == 0 && len(rows) > 1 && tableDivider.MatchString(rows[1]) {
+			cell = "th"
+		}
+		r.out.WriteString("<tr>")
+		for _, value := range splitTableRow(row) {
+			fmt.Fprintf(&r.out, "<%s>%s</%s>", cell, renderInline(value), cell)
+		}
+		r.out.WriteString("</tr>\n")
+	}
+	r.out.WriteString("</table>\n")
+}
+
+func splitTableRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// linkSchemes are the URL schemes rendered as links. Links with any other
+// scheme, such as javascript:, data: or vbscript:, are shown as their text.
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// safeLink reports whether an escaped link target is relative, a fragment,
+// or uses one of linkSchemes. Targets that don't parse are refused, since a
+// browser may read them differently.
+func safeLink(href string) bool {
+	u, err := url.Parse(html.UnescapeString(href))
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || linkSchemes[strings.ToLower(u.Scheme)]
+}
+
+// renderInline escapes text and converts code spans, links and emphasis.
+// Code spans are left untouched by the other conversions.
+func renderInline(text string) string {
+	var sb strings.Builder
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		// An unmatched final backtick is literal text
+		if i == len(parts)-1 && i%2 == 1 {
+			part = "`" + part
+		} else if i%2 == 1 {
+			sb.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+
+		part = html.EscapeString(part)
+		part = linkSpan.ReplaceAllStringFunc(part, func(link string) string {
+			m := linkSpan.FindStringSubmatch(link)
+			if !safeLink(m[2]) {
+				return m[1]
+			}
+			return fmt.Sprintf(`<a href="%s">%s</a>`, m[2], m[1])
+		})
+		part = strongSpan.ReplaceAllString(part, "<strong>$1</strong>")
+		part = emSpan.ReplaceAllString(part, "<em>$1</em>")
+		sb.WriteString(part)
+	}
+	return sb.String()
+}
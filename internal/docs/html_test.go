@@ -0,0 +1,31 @@
+package docs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderInlineLinks(t *testing.T) {
+	tests := []struct {
+		markdown string
+		linked   bool
+	}{
+		{"[site](https://example.com/a?b=c)", true},
+		{"[site](http://example.com)", true},
+		{"[mail](mailto:dev@example.com)", true},
+		{"[usage](usage.md)", true},
+		{"[up](../README.md)", true},
+		{"[section](#install)", true},
+		{"[x](javascript:alert(1))", false},
+		{"[x](JavaScript:alert(1))", false},
+		{"[x](data:text/html;base64,PHNjcmlwdD4=)", false},
+		{"[x](vbscript:msgbox)", false},
+		{"[x](file:///etc/passwd)", false},
+	}
+	for _, tt := range tests {
+		got := renderInline(tt.markdown)
+		if linked := strings.Contains(got, "<a href="); linked != tt.linked {
+			t.Errorf("renderInline(%q) = %q, linked %v, want %v", tt.markdown, got, linked, tt.linked)
+		}
+	}
+}
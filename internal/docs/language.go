@@ -0,0 +1,80 @@
+package docs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// languageNames maps common language codes to the names used in prompts.
+// Other values are passed to the model as given.
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// languagePattern accepts codes like es or pt-BR and names like Spanish
+var languagePattern = regexp.MustCompile(`^[A-Za-z]+(?:[ -][A-Za-z]+)*$`)
+
+// NormalizeLanguage validates a documentation language and returns it in
+// the form recorded in Metadata: a lower-case code or name, with English
+// as "" since it's the default.
+func NormalizeLanguage(lang string) (string, error) {
+	lang = strings.TrimSpace(lang)
+	if lang == "" {
+		return "", nil
+	}
+	if !languagePattern.MatchString(lang) {
+		return "", fmt.Errorf("invalid documentation language %q: use a code such as es or a name such as Spanish", lang)
+	}
+	lang = strings.ToLower(lang)
+	if lang == "en" || lang == "english" || strings.HasPrefix(lang, "en-") {
+		return "", nil
+	}
+	return lang, nil
+}
+
+// languageName returns the name of the generator's language for prompts
+func (g *Generator) languageName() string {
+	base, _, _ := strings.Cut(g.Language, "-")
+	if name, ok := languageNames[base]; ok {
+		if base != g.Language {
+			return name + " (" + g.Language + ")"
+		}
+		return name
+	}
+	return g.Language
+}
+
+// languageInstruction asks for the documentation in the configured
+// language, leaving code as it is in the repository
+func (g *Generator) languageInstruction() string {
+	if g.Language == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n=== Output language ===\nWrite all prose and headings in %s. Keep code blocks, code identifiers, file paths, commands and configuration keys exactly as they appear in the repository, untranslated.\n=== End of output language ===\n",
+		g.languageName())
+}
+
+// languageLabel names a recorded language for log messages
+func languageLabel(lang string) string {
+	if lang == "" {
+		return "English"
+	}
+	return lang
+}
@@ -0,0 +1,29 @@
+package docs
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// wordsPerMinute is the reading speed used to estimate reading time
+const wordsPerMinute = 200
+
+// RecordLength counts the words and characters of the final documentation,
+// estimates how long it takes to read, and saves them in the metadata.
+func (g *Generator) RecordLength() error {
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read full documentation: %w", err)
+	}
+
+	g.Meta.WordCount = len(strings.Fields(content))
+	g.Meta.CharCount = utf8.RuneCountInString(content)
+	g.Meta.ReadingMinutes = readingMinutes(g.Meta.WordCount)
+	return g.saveMetadata()
+}
+
+// readingMinutes rounds up, so any non-empty document takes at least a minute
+func readingMinutes(words int) int {
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
@@ -0,0 +1,199 @@
+package docs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+const (
+	linkTimeout   = 10 * time.Second // per external link request
+	linkCheckers  = 4                // external links checked at once
+	linkUserAgent = "repocontext-link-checker"
+)
+
+var (
+	// inlineLink matches [text](target "title") and ![alt](target)
+	inlineLink = regexp.MustCompile(`!?\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+["'(][^)]*)?\)`)
+	// referenceLink matches a reference definition: [id]: target "title"
+	referenceLink = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*<?([^\s>]+)>?`)
+	// codeSpan matches inline code, whose contents aren't links
+	codeSpan = regexp.MustCompile("`[^`]*`")
+)
+
+// LinkProblem is a link in full.md that doesn't resolve
+type LinkProblem struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// CheckLinks checks every markdown link in full.md: relative links must name
+// a file or directory in the repository, and external http(s) links must
+// answer 2xx. External links are skipped when httpClient is nil. Each
+// problem is logged as a warning.
+func (g *Generator) CheckLinks(ctx context.Context, httpClient *http.Client) ([]LinkProblem, error) {
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read full documentation: %w", err)
+	}
+
+	var problems []LinkProblem
+	var external []string
+	for _, target := range extractLinks(content) {
+		switch {
+		case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+			external = append(external, target)
+		case strings.HasPrefix(target, "#"), strings.Contains(target, ":"):
+			// Anchors and other schemes (mailto:, data: ...) aren't checked
+		default:
+			if reason := g.checkRelativeLink(target); reason != "" {
+				problems = append(problems, LinkProblem{Target: target, Reason: reason})
+			}
+		}
+	}
+	if httpClient != nil {
+		problems = append(problems, checkExternalLinks(ctx, httpClient, external)...)
+	}
+
+	for _, problem := range problems {
+		logger.Warnf("broken link in %s: %s (%s)\n", FullDocFileName, problem.Target, problem.Reason)
+	}
+	return problems, nil
+}
+
+// extractLinks returns the distinct link targets outside code, in order of
+// first appearance
+func extractLinks(content string) []string {
+	seen := make(map[string]bool)
+	var links []string
+	add := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			links = append(links, target)
+		}
+	}
+
+	inFence := false
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		line = codeSpan.ReplaceAllString(line, "")
+		if match := referenceLink.FindStringSubmatch(line); match != nil {
+			add(match[1])
+			continue
+		}
+		for _, match := range inlineLink.FindAllStringSubmatch(line, -1) {
+			add(match[1])
+		}
+	}
+	return links
+}
+
+// checkRelativeLink resolves target against the repository root and
+// returns why it's broken, or "" if it exists
+func (g *Generator) checkRelativeLink(target string) string {
+	path, _, _ := strings.Cut(target, "#")
+	path, _, _ = strings.Cut(path, "?")
+	if path == "" {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(path, "/")))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "points outside the repository"
+	}
+	if _, err := os.Stat(filepath.Join(g.RepoPath, clean)); err != nil {
+		return "no such file in the repository"
+	}
+	return ""
+}
+
+// checkExternalLinks requests each URL and reports those that fail or
+// answer with a non-2xx status
+func checkExternalLinks(ctx context.Context, httpClient *http.Client, urls []string) []LinkProblem {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		problems []LinkProblem
+	)
+	sem := make(chan struct{}, linkCheckers)
+	for _, target := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if reason := checkURL(ctx, httpClient, target); reason != "" {
+				mu.Lock()
+				problems = append(problems, LinkProblem{Target: target, Reason: reason})
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	// Keep the report stable regardless of which request finished first
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Target < problems[j].Target })
+	return problems
+}
+
+// checkURL returns why target is broken, or "" if it answers 2xx. Servers
+// that refuse HEAD are retried with GET.
+func checkURL(ctx context.Context, httpClient *http.Client, target string) string {
+	status, err := requestStatus(ctx, httpClient, http.MethodHead, target)
+	switch status {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden:
+		status, err = requestStatus(ctx, httpClient, http.MethodGet, target)
+	}
+	switch {
+	case err != nil:
+		return err.Error()
+	case status < 200 || status >= 300:
+		return fmt.Sprintf("status %d", status)
+	}
+	return ""
+}
+
+func requestStatus(ctx context.Context, httpClient *http.Client, method, target string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, linkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", linkUserAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return 0, fmt.Errorf("no response within %s", linkTimeout)
+		}
+		// The URL is already in the report
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return 0, urlErr.Err
+		}
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
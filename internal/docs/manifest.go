@@ -0,0 +1,224 @@
+package docs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// manifestAttempts bounds how often the model is asked for the manifest
+// before a reply that isn't valid JSON fails the run
+const manifestAttempts = 2
+
+// Manifest describes a repository's structure for other tools: what it
+// is, where to start reading, what each top-level directory holds, and
+// what it depends on. It's written to manifest.json beside the markdown.
+type Manifest struct {
+	Repository   string               `json:"repository"`
+	CommitHash   string               `json:"commit_hash"`
+	Description  string               `json:"description"`
+	EntryPoints  []ManifestEntryPoint `json:"entry_points"`
+	Directories  []ManifestDirectory  `json:"directories"`
+	Languages    map[string]int       `json:"languages"` // lines of code by language, counted rather than asked for
+	Dependencies []ManifestDependency `json:"dependencies"`
+}
+
+// ManifestEntryPoint is a file a program or library starts from
+type ManifestEntryPoint struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+// ManifestDirectory is a top-level directory and a one-line purpose
+type ManifestDirectory struct {
+	Path    string `json:"path"`
+	Purpose string `json:"purpose"`
+}
+
+// ManifestDependency is a dependency declared in one of the repository's
+// manifests, such as go.mod or package.json
+type ManifestDependency struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Manifest string `json:"manifest"` // the file declaring it
+}
+
+// invalidManifestReminder is appended to the manifest prompt on a retry
+const invalidManifestReminder = `
+
+Your previous reply could not be parsed as JSON (%v). Reply with valid JSON only, matching the schema above exactly: no introduction, commentary or code fences.`
+
+// LoadManifest reads the manifest.json written beside the docs
+func LoadManifest(docsPath string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(docsPath, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFileName, err)
+	}
+	return &manifest, nil
+}
+
+// GenerateManifest writes manifest.json from the selected files, reusing
+// an existing one for the commit. The model is asked for JSON, and asked
+// once more if its reply doesn't parse. Entry points and directories it
+// names that don't exist are dropped, and every top-level directory is
+// listed even if the model left it out.
+func (g *Generator) GenerateManifest(ctx context.Context, files map[string]*git.RepoFile) (*Manifest, error) {
+	if manifest, err := LoadManifest(g.DocsPath); err == nil {
+		logger.Println("Using cached manifest...")
+		return manifest, nil
+	} else if !os.IsNotExist(err) {
+		logger.Printf("Ignoring cached manifest: %v\n", err)
+	}
+
+	// Files are already loaded when the docs were just generated
+	if len(g.Files) == 0 {
+		if err := g.loadFiles(files); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.fitFiles(g.manifestPrompts); err != nil {
+		return nil, err
+	}
+
+	logger.Println("\nGenerating manifest...")
+	prompt := g.manifestPrompt()
+	var manifest *Manifest
+	for attempt := 1; attempt <= manifestAttempts; attempt++ {
+		completion, err := g.LLMClient.GenerateWithStream(ctx, systemPrompt, prompt, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate manifest: %w", err)
+		}
+		if manifest, err = parseManifest(completion); err == nil {
+			break
+		}
+		if attempt == manifestAttempts {
+			return nil, fmt.Errorf("model returned invalid manifest JSON after %d attempts: %w", manifestAttempts, err)
+		}
+		logger.Printf("Manifest reply was not valid JSON (%v), retrying...\n", err)
+		prompt = g.manifestPrompt() + fmt.Sprintf(invalidManifestReminder, err)
+	}
+
+	g.checkManifest(manifest)
+	manifest.Repository = g.RepoName
+	if g.Meta != nil {
+		manifest.CommitHash = g.Meta.CommitHash
+		manifest.Languages = g.Meta.LinesByLanguage
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(g.DocsPath, ManifestFileName), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", fileError(err))
+	}
+	return manifest, nil
+}
+
+// parseManifest decodes the JSON object in a reply, tolerating code fences
+// and text around it
+func parseManifest(completion string) (*Manifest, error) {
+	text := stripCodeFenceLines(completion)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, errors.New("no JSON object in the reply")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal([]byte(text[start:end+1]), &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// checkManifest drops entry points and directories that aren't in the
+// repository, and adds any top-level directory the model left out
+func (g *Generator) checkManifest(manifest *Manifest) {
+	exists := func(path string) bool {
+		clean := filepath.Clean(filepath.FromSlash(path))
+		if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || filepath.IsAbs(clean) {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(g.RepoPath, clean))
+		return err == nil
+	}
+
+	entryPoints := manifest.EntryPoints[:0]
+	for _, entry := range manifest.EntryPoints {
+		if !exists(entry.Path) {
+			logger.Verbosef("Dropping manifest entry point %s: no such file\n", entry.Path)
+			continue
+		}
+		entryPoints = append(entryPoints, entry)
+	}
+	manifest.EntryPoints = entryPoints
+
+	purposes := make(map[string]string)
+	for _, dir := range manifest.Directories {
+		purposes[strings.Trim(filepath.ToSlash(dir.Path), "/")] = dir.Purpose
+	}
+	manifest.Directories = nil
+	for _, dir := range g.topLevelDirs() {
+		manifest.Directories = append(manifest.Directories, ManifestDirectory{Path: dir, Purpose: purposes[dir]})
+	}
+}
+
+// topLevelDirs lists the repository's top-level directories, leaving out
+// hidden ones such as .git
+func (g *Generator) topLevelDirs() []string {
+	entries, err := os.ReadDir(g.RepoPath)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// manifestPrompt assembles the prompt for manifest.json
+func (g *Generator) manifestPrompt() string {
+	dirs := "(none)"
+	if names := g.topLevelDirs(); len(names) > 0 {
+		dirs = strings.Join(names, ", ")
+	}
+	return g.withInstructions(g.profileNote() + fmt.Sprintf(`Based on the repository files provided below, describe the repository's structure as a JSON object matching this schema exactly:
+
+{
+  "description": "one sentence on what the project does",
+  "entry_points": [{"path": "cmd/app/main.go", "description": "what running or importing it does"}],
+  "directories": [{"path": "internal", "purpose": "one line on what the directory holds"}],
+  "dependencies": [{"name": "github.com/spf13/cobra", "version": "v1.8.0", "manifest": "go.mod"}]
+}
+
+- entry_points: the files a program starts from or a library is imported through, using paths from the listing
+- directories: one entry for each top-level directory: %s
+- dependencies: those declared in the manifests shown (go.mod, package.json, pyproject.toml, Cargo.toml and the like), with versions as written there, or an empty version if none is given; use [] if no manifest is shown
+
+Reply ONLY with the JSON object: no introduction, commentary or code fences.
+
+%sRepository structure:
+%s
+Contents:
+%s`, dirs, g.frameworkHint(), g.formatFileTree(), g.formatFileContents()))
+}
+
+// manifestPrompts returns the manifest prompt, for fitFiles
+func (g *Generator) manifestPrompts() ([]string, error) {
+	return []string{g.manifestPrompt()}, nil
+}
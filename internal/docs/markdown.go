@@ -0,0 +1,101 @@
+package docs
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+)
+
+// mdxImport matches an ES import line at the top level of an MDX file
+var mdxImport = regexp.MustCompile(`^import\s.+\sfrom\s+['"][^'"]+['"];?\s*$|^import\s+['"][^'"]+['"];?\s*$`)
+
+// cleanDocInput strips parts of markdown inputs, and of files configured as
+// documentation, that only matter to site generators (YAML frontmatter, MDX
+// imports) and would otherwise be echoed by the model. Other files are
+// returned unchanged.
+func cleanDocInput(path, content string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".md" && ext != ".mdx" && !git.MatchesDocGlobs(path) {
+		return content
+	}
+
+	content = stripFrontmatter(content)
+	if ext != ".mdx" {
+		return content
+	}
+
+	var kept []string
+	inFence := false
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			inFence = !inFence
+		}
+		if !inFence && mdxImport.MatchString(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimLeft(strings.Join(kept, "\n"), "\n")
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
+
+// fencesBalanced reports whether every opening ``` has a closing one
+func fencesBalanced(content string) bool {
+	count := 0
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			count++
+		}
+	}
+	return count%2 == 0
+}
+
+// codeBlocks returns the bodies of all fenced code blocks, whitespace-normalized
+func codeBlocks(content string) []string {
+	var blocks []string
+	var current []string
+	inFence := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			if inFence {
+				blocks = append(blocks, strings.Join(strings.Fields(strings.Join(current, "\n")), " "))
+				current = nil
+			}
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			current = append(current, line)
+		}
+	}
+
+	return blocks
+}
+
+// checkCodePreserved verifies that cleaned output still has balanced fences
+// and contains every code block from the original.
+func checkCodePreserved(original, cleaned string) error {
+	if !fencesBalanced(cleaned) {
+		return fmt.Errorf("unbalanced code fences")
+	}
+
+	normalized := strings.Join(strings.Fields(cleaned), " ")
+	missing := 0
+	for _, block := range codeBlocks(original) {
+		if block != "" && !strings.Contains(normalized, block) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d code block(s) missing", missing)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// UnprocessedFileName keeps full.md as it was before post-processing. It
+// doesn't end in .md, so it's never served or listed as a doc.
+const UnprocessedFileName = "full.md.orig"
+
+// PostProcess pipes full.md through a shell command and replaces it with
+// the command's output, failing if the command exits non-zero. The
+// unprocessed document is kept beside it and restored when cached docs are
+// loaded, so every run transforms the document afresh rather than the
+// output of an earlier run.
+func (g *Generator) PostProcess(ctx context.Context, command string) error {
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read full documentation: %w", err)
+	}
+
+	logger.Printf("\nPost-processing %s with %q...\n", FullDocFileName, command)
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = g.DocsPath
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("post-process command %q failed: %w: %s", command, err, msg)
+		}
+		return fmt.Errorf("post-process command %q failed: %w", command, err)
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return fmt.Errorf("post-process command %q produced no output", command)
+	}
+
+	if err := os.WriteFile(filepath.Join(g.DocsPath, UnprocessedFileName), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to save unprocessed documentation: %w", fileError(err))
+	}
+	if err := g.writeDoc(FullDocFileName, stdout.String()); err != nil {
+		return fmt.Errorf("failed to write post-processed documentation: %w", err)
+	}
+	g.Meta.PostProcessed = true
+	return g.saveMetadata()
+}
+
+// restoreUnprocessed puts back the full.md an earlier run post-processed,
+// so the cleanup pass and PostProcess see the document they produced
+func (g *Generator) restoreUnprocessed() error {
+	if !g.Meta.PostProcessed {
+		return nil
+	}
+	content, err := os.ReadFile(filepath.Join(g.DocsPath, UnprocessedFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read unprocessed documentation: %w", fileError(err))
+	}
+	if err := g.writeDoc(FullDocFileName, string(content)); err != nil {
+		return fmt.Errorf("failed to restore unprocessed documentation: %w", err)
+	}
+	g.Meta.PostProcessed = false
+	return nil
+}
+
+// shellCommand runs command with the platform's shell, so pipelines and
+// quoting work as typed
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
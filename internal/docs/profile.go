@@ -0,0 +1,53 @@
+package docs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// profileKind recognises GitHub's special repositories, whose README is
+// shown on a profile page rather than describing a software project:
+// user/user is a personal profile, and an organization's .github repo holds
+// its profile and default community files. It returns "" for other repos.
+func profileKind(repoName string) string {
+	user, repo, ok := strings.Cut(repoName, "/")
+	switch {
+	case !ok:
+		return ""
+	case strings.EqualFold(user, repo):
+		return "personal profile repository"
+	case strings.EqualFold(repo, ".github"):
+		return "organization meta-repository (.github)"
+	}
+	return ""
+}
+
+// profileNote tells the model it is documenting a profile or meta-repo, so
+// the README isn't written up as "the project". It's empty for other repos.
+func (g *Generator) profileNote() string {
+	kind := profileKind(g.RepoName)
+	if kind == "" {
+		return ""
+	}
+	return fmt.Sprintf(`Note: %s is a GitHub %s, not a software project. Its README is displayed on the account's profile page, and any other files are profile assets, shared workflows or default community health files. Describe it as such: do not present the README's content as a product, and do not invent installation steps, APIs or features.
+
+`, g.RepoName, kind)
+}
+
+// buildProfileOverviewPrompt replaces the overview prompt for a profile or
+// meta-repo
+func (g *Generator) buildProfileOverviewPrompt() string {
+	return fmt.Sprintf(`%sBased on the repository files provided below, create an overview document in markdown format that includes:
+
+1. Whose profile or organization this repository belongs to, and what it presents to visitors
+2. What the profile README covers (e.g. projects, interests, links), summarized rather than reproduced
+3. Any other files and what they provide, such as shared workflows, issue templates or contribution guidelines
+4. How the repository is maintained, if it can be determined (e.g. automated README updates)
+
+Please ensure the output is well-formatted markdown with appropriate headers and sections.
+
+Repository structure:
+%s
+Contents:
+%s`, g.profileNote(), g.formatFileTree(), g.formatFileContents())
+}
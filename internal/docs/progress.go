@@ -0,0 +1,65 @@
+package docs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// ProgressFileName records the sections a run that hasn't finished has
+// written, and the model that wrote each, so a rerun reuses exactly those.
+// It's removed once the run's metadata is saved.
+const ProgressFileName = "progress.json"
+
+// progress is what a run has finished so far. Sections only count for the
+// commit and documentation language they were written for.
+type progress struct {
+	CommitHash string            `json:"commit_hash"`
+	Language   string            `json:"language,omitempty"`
+	Sections   map[string]string `json:"sections"` // finished section file -> model that wrote it
+}
+
+// saveProgress flushes the sections finished so far. Callers generating
+// sections in parallel hold the lock guarding Meta.SectionModels.
+func (g *Generator) saveProgress() error {
+	saved := progress{CommitHash: g.Meta.CommitHash, Language: g.Meta.Language, Sections: g.Meta.SectionModels}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal progress: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(g.DocsPath, ProgressFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write progress: %w", fileError(err))
+	}
+	return nil
+}
+
+// loadProgress returns the sections an earlier unfinished run for the same
+// commit and language completed, with the model that wrote each, or nil if
+// there was no such run
+func (g *Generator) loadProgress() map[string]string {
+	data, err := os.ReadFile(filepath.Join(g.DocsPath, ProgressFileName))
+	if err != nil {
+		return nil
+	}
+	var saved progress
+	if err := json.Unmarshal(data, &saved); err != nil {
+		logger.Verbosef("Ignoring unreadable %s: %v\n", ProgressFileName, err)
+		return nil
+	}
+	if saved.CommitHash != g.Meta.CommitHash || saved.Language != g.Meta.Language {
+		logger.Verbosef("Ignoring %s from a run for another commit or language\n", ProgressFileName)
+		return nil
+	}
+	return saved.Sections
+}
+
+// clearProgress removes the progress file once the run is complete
+func (g *Generator) clearProgress() error {
+	if err := os.Remove(filepath.Join(g.DocsPath, ProgressFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove progress: %w", fileError(err))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package docs
+
+import "github.com/johnknott/repocontext/internal/git"
+
+// Prompt is an assembled prompt and the doc file it would produce
+type Prompt struct {
+	Name   string
+	System string // system message sent with Text
+	Text   string
+}
+
+// Prompts builds the exact prompts the sections, or with summaryOnly the
+// summary, would be generated from, without calling the model. Files are
+// read, cleaned, redacted and trimmed to fit as for a real run. The cleanup
+// prompt isn't included, since it is built from the generated sections.
+func (g *Generator) Prompts(files map[string]*git.RepoFile, summaryOnly bool) ([]Prompt, error) {
+	if err := g.loadFiles(files); err != nil {
+		return nil, err
+	}
+
+	if summaryOnly {
+		if err := g.fitFiles(g.summaryPrompts); err != nil {
+			return nil, err
+		}
+		return []Prompt{{Name: SummaryFileName, System: systemPrompt, Text: g.summaryPrompt()}}, nil
+	}
+	if err := g.fitFiles(g.sectionPrompts); err != nil {
+		return nil, err
+	}
+
+	prompts := make([]Prompt, 0, len(g.Sections))
+	for _, section := range g.Sections {
+		text, err := g.sectionPrompt(section)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, Prompt{Name: section, System: systemPrompt, Text: text})
+	}
+	return prompts, nil
+}
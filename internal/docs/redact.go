@@ -0,0 +1,126 @@
+package docs
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+const (
+	redactedPlaceholder = "***REDACTED***"
+
+	// Tokens at least this long with this much entropy per character are
+	// assumed to be secrets even without a known pattern.
+	minSecretTokenLength = 32
+	minSecretEntropy     = 4.5
+)
+
+// DefaultRedactPatterns match common secrets. If a pattern has a group named
+// "secret", only that group is masked, so "API_KEY=abc" keeps its key name.
+var DefaultRedactPatterns = []string{
+	`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}`,
+	`\bsk-ant-[A-Za-z0-9_-]{20,}`,
+	`(?im)^\s*(?:export\s+)?[a-z0-9_.-]*(?:api_?key|secret|token|passw(?:or)?d)[a-z0-9_.-]*\s*[=:]\s*["']?(?P<secret>[^\s"'#()]{8,})(?:["'\s]|$)`,
+}
+
+var secretToken = regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`)
+
+// CompileRedactPatterns compiles secret patterns for Generator.Redact
+func CompileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// redactSecrets masks every match of patterns, plus long high-entropy
+// tokens, and returns the cleaned content with the number of redactions.
+func redactSecrets(content string, patterns []*regexp.Regexp) (string, int) {
+	count := 0
+	for _, re := range patterns {
+		var n int
+		content, n = redactPattern(content, re)
+		count += n
+	}
+
+	content = secretToken.ReplaceAllStringFunc(content, func(token string) string {
+		if !looksRandom(token) {
+			return token
+		}
+		count++
+		return redactedPlaceholder
+	})
+
+	return content, count
+}
+
+func redactPattern(content string, re *regexp.Regexp) (string, int) {
+	group := 0
+	if idx := re.SubexpIndex("secret"); idx > 0 {
+		group = idx
+	}
+
+	matches := re.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content, 0
+	}
+
+	var sb strings.Builder
+	last, count := 0, 0
+	for _, m := range matches {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 || content[start:end] == redactedPlaceholder {
+			continue
+		}
+		sb.WriteString(content[last:start])
+		sb.WriteString(redactedPlaceholder)
+		last = end
+		count++
+	}
+	sb.WriteString(content[last:])
+	return sb.String(), count
+}
+
+// looksRandom reports whether a token mixes letters and digits and has
+// enough entropy to be a key rather than an identifier or a hex hash.
+func looksRandom(token string) bool {
+	if len(token) < minSecretTokenLength || !strings.ContainsAny(token, "0123456789") {
+		return false
+	}
+	if strings.ToLower(token) == token || strings.ToUpper(token) == token {
+		return false
+	}
+
+	freq := make(map[rune]int)
+	for _, r := range token {
+		freq[r]++
+	}
+	var entropy float64
+	for _, n := range freq {
+		p := float64(n) / float64(len(token))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minSecretEntropy
+}
+
+// redactFiles masks secrets in every loaded file, logging counts per file
+func (g *Generator) redactFiles() {
+	for _, path := range g.sortedFiles() {
+		cleaned, n := redactSecrets(g.Files[path], g.Redact)
+		if n > 0 {
+			g.Files[path] = cleaned
+			logger.Printf("Redacted %d possible secret(s) in %s\n", n, path)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package docs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// summarizeFiles replaces each file's content with an LLM summary for
+// incremental mode. Summaries are cached in SummaryDir by content hash, so
+// only files that changed since an earlier run cost a model call.
+func (g *Generator) summarizeFiles(ctx context.Context) error {
+	if err := os.MkdirAll(g.SummaryDir, 0755); err != nil {
+		return fmt.Errorf("failed to create summary directory: %w", fileError(err))
+	}
+
+	cached := 0
+	summaries := make(map[string]string, len(g.Files))
+	for _, path := range g.sortedFiles() {
+		content := g.Files[path]
+		sum := sha256.Sum256([]byte(content))
+		cachePath := filepath.Join(g.SummaryDir, hex.EncodeToString(sum[:])+".md")
+
+		if summary, err := os.ReadFile(cachePath); err == nil {
+			summaries[path] = string(summary)
+			cached++
+			continue
+		}
+
+		logger.Printf("Summarizing %s...\n", path)
+		summary, err := g.LLMClient.GenerateWithStream(ctx, systemPrompt, buildSummaryPrompt(path, content), nil)
+		if err != nil {
+			return fmt.Errorf("failed to summarize %s: %w", path, err)
+		}
+		if err := os.WriteFile(cachePath, []byte(summary), 0644); err != nil {
+			return fmt.Errorf("failed to cache summary of %s: %w", path, fileError(err))
+		}
+		summaries[path] = summary
+	}
+
+	logger.Printf("Using %d cached and %d new file summaries\n", cached, len(summaries)-cached)
+	g.Files = summaries
+	return nil
+}
+
+func buildSummaryPrompt(path, content string) string {
+	return fmt.Sprintf(`Summarize the following file from a software repository. The summary will be used instead of the file to write the project's documentation, so include:
+
+1. What the file is for
+2. Public APIs, commands, or configuration options it defines
+3. Any setup or usage steps it describes
+4. Short code snippets worth quoting in usage examples, verbatim
+
+Reply in markdown with no preamble.
+
+=== %s ===
+%s`, path, strings.TrimSpace(content))
+}
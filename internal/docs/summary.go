@@ -0,0 +1,65 @@
+package docs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// GenerateSummary writes a single-paragraph description of the project to
+// summary.md and returns it, reusing an existing summary for the commit.
+// It makes one model call and skips the sections and the cleanup pass.
+func (g *Generator) GenerateSummary(ctx context.Context, files map[string]*git.RepoFile, meta *Metadata) (string, error) {
+	g.Meta = meta
+	if summary, err := g.readDoc(SummaryFileName); err == nil && strings.TrimSpace(summary) != "" {
+		logger.Println("Using cached summary...")
+		return summary, nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read cached summary: %w", err)
+	}
+
+	if err := g.loadFiles(files); err != nil {
+		return "", err
+	}
+	if err := g.fitFiles(g.summaryPrompts); err != nil {
+		return "", err
+	}
+
+	logger.Println("\nGenerating summary...")
+	summary, err := g.LLMClient.GenerateWithStream(ctx, systemPrompt, g.summaryPrompt(), g.Stream)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %w", err)
+	}
+	summary = strings.TrimSpace(summary) + "\n"
+
+	if err := g.writeDoc(SummaryFileName, summary); err != nil {
+		return "", fmt.Errorf("failed to write summary: %w", err)
+	}
+	return summary, nil
+}
+
+// summaryPrompt assembles the full prompt for summary.md
+func (g *Generator) summaryPrompt() string {
+	return g.withInstructions(g.profileNote() + g.buildSummaryOnlyPrompt())
+}
+
+// summaryPrompts returns the summary prompt, for fitFiles
+func (g *Generator) summaryPrompts() ([]string, error) {
+	return []string{g.summaryPrompt()}, nil
+}
+
+func (g *Generator) buildSummaryOnlyPrompt() string {
+	return fmt.Sprintf(`Based on the repository files provided below, write a single paragraph of about 100 words describing what the project does, who it is for, and its main technologies.
+
+Reply with the paragraph only: no title, headings, lists or code blocks.
+
+%sRepository structure:
+%s
+Contents:
+%s`, g.frameworkHint(), g.formatFileTree(), g.formatFileContents())
+}
@@ -0,0 +1,117 @@
+package docs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+const (
+	minTags = 5
+	maxTags = 10
+
+	// tagsMarker starts the footer listing tags in full.md when frontmatter
+	// is off, so the footer can be found and replaced on later writes.
+	tagsMarker = "<!-- repocontext:tags -->"
+)
+
+// listMarker matches a bullet, number or hash in front of a tag
+var listMarker = regexp.MustCompile(`^(\d+[.)]|[-*#]+)\s*`)
+
+// ExtractTags asks the model for topic tags describing the final
+// documentation, and stores them in the metadata and in full.md. Docs that
+// already have tags are left alone. A failed request only warns, since the
+// docs themselves are complete.
+func (g *Generator) ExtractTags(ctx context.Context) error {
+	if len(g.Meta.Tags) > 0 {
+		return nil
+	}
+
+	content, err := g.readDoc(FullDocFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read full documentation: %w", err)
+	}
+
+	prompt := fmt.Sprintf(`Read the documentation below and list %d to %d short topic tags that describe the project, for search and indexing.
+Use lowercase words or short hyphenated phrases, e.g. "cli", "static-analysis", "kubernetes".
+Reply ONLY with the tags, one per line.
+
+Documentation:
+%s`, minTags, maxTags, content)
+
+	if !g.promptFits(prompt) {
+		logger.Warnf("skipping tags: the documentation is too large for the %d token context window\n", g.ContextWindow)
+		return nil
+	}
+
+	logger.Println("\nExtracting topic tags...")
+	completion, err := g.LLMClient.GenerateWithStream(ctx, systemPrompt, prompt, nil)
+	if err != nil {
+		logger.Warnf("failed to extract tags: %v\n", err)
+		return nil
+	}
+
+	tags := parseTags(completion)
+	if len(tags) == 0 {
+		logger.Warnf("model returned no usable tags\n")
+		return nil
+	}
+	logger.Printf("Tags: %s\n", strings.Join(tags, ", "))
+
+	g.Meta.Tags = tags
+	if err := g.writeDoc(FullDocFileName, content); err != nil {
+		return fmt.Errorf("failed to write tags to documentation: %w", err)
+	}
+	return g.saveMetadata()
+}
+
+// parseTags splits a reply into lowercase, deduplicated tags, accepting
+// lines or commas and dropping list markers and hashes.
+func parseTags(completion string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(stripCodeFenceLines(completion), func(r rune) bool {
+		return r == '\n' || r == ','
+	}) {
+		tag := strings.ToLower(strings.TrimSpace(field))
+		tag = listMarker.ReplaceAllString(tag, "")
+		tag = strings.Trim(tag, "`\"' ")
+		tag = strings.Join(strings.Fields(tag), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
+
+// stripCodeFenceLines drops ``` lines from a reply wrapped in a code block
+func stripCodeFenceLines(content string) string {
+	var kept []string
+	for _, line := range strings.Split(content, "\n") {
+		if !isFence(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// tagsFooter renders the tags as a footer for full.md
+func tagsFooter(tags []string) string {
+	return "\n\n" + tagsMarker + "\nTags: " + strings.Join(tags, ", ") + "\n"
+}
+
+// stripTagsFooter removes a footer written by tagsFooter, if any
+func stripTagsFooter(content string) string {
+	if idx := strings.LastIndex(content, tagsMarker); idx != -1 {
+		return strings.TrimRight(content[:idx], "\n") + "\n"
+	}
+	return content
+}
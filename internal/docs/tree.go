@@ -0,0 +1,89 @@
+package docs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	maxTreeDepth   = 6
+	maxTreeEntries = 400
+)
+
+type treeNode struct {
+	children map[string]*treeNode
+	files    int    // number of files at or below this node
+	label    string // shown after a file's name
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: make(map[string]*treeNode)}
+}
+
+// renderTree renders paths as an indented tree, like the `tree` command.
+// Files with an entry in labels have it appended to their name. Directories
+// deeper than maxDepth are collapsed into a file count, and output stops
+// after maxEntries lines.
+func renderTree(paths []string, labels map[string]string, maxDepth, maxEntries int) string {
+	root := newTreeNode()
+	for _, path := range paths {
+		node := root
+		for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+			child, ok := node.children[part]
+			if !ok {
+				child = newTreeNode()
+				node.children[part] = child
+			}
+			child.files++
+			node = child
+		}
+		node.label = labels[path]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(".\n")
+	entries := 0
+	truncated := false
+	var walk func(node *treeNode, prefix string, depth int)
+	walk = func(node *treeNode, prefix string, depth int) {
+		names := make([]string, 0, len(node.children))
+		for name := range node.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for i, name := range names {
+			if entries >= maxEntries {
+				truncated = true
+				return
+			}
+			entries++
+
+			child := node.children[name]
+			connector, indent := "├── ", "│   "
+			if i == len(names)-1 {
+				connector, indent = "└── ", "    "
+			}
+
+			switch {
+			case len(child.children) == 0 && child.label != "":
+				sb.WriteString(prefix + connector + name + " " + child.label + "\n")
+			case len(child.children) == 0:
+				sb.WriteString(prefix + connector + name + "\n")
+			case depth >= maxDepth:
+				sb.WriteString(fmt.Sprintf("%s%s%s/ (%d files)\n", prefix, connector, name, child.files))
+			default:
+				sb.WriteString(prefix + connector + name + "/\n")
+				walk(child, prefix+indent, depth+1)
+			}
+		}
+	}
+	walk(root, "", 1)
+
+	if truncated {
+		sb.WriteString(fmt.Sprintf("... (tree truncated after %d entries)\n", maxEntries))
+	}
+	return sb.String()
+}
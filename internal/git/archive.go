@@ -0,0 +1,324 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// archiveSuffixes are the archive formats accepted in place of user/repo
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".zip"}
+
+// errNoHistory is returned for commit history of an extracted archive
+var errNoHistory = errors.New("an archive has no commit history")
+
+// IsArchiveURL reports whether arg is an http(s) URL of a tarball or zip
+func IsArchiveURL(arg string) bool {
+	u, err := url.Parse(arg)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+	return archiveSuffix(u.Path) != ""
+}
+
+func archiveSuffix(urlPath string) string {
+	lower := strings.ToLower(urlPath)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// parseArchiveURL names an archive after its host and path, so the cache
+// layout matches that of clones: <host>/<path with slashes as _>
+func parseArchiveURL(raw string) (*Repository, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL %q: %w", raw, err)
+	}
+	name := strings.Trim(u.Path[:len(u.Path)-len(archiveSuffix(u.Path))], "/")
+	name = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(name)
+	if name == "" {
+		name = "archive"
+	}
+	return &Repository{User: strings.ReplaceAll(u.Host, ":", "_"), Repo: name, ArchiveURL: raw}, nil
+}
+
+// IsArchive reports whether the repository is an extracted archive rather
+// than a git clone
+func (r *Repository) IsArchive() bool {
+	return r.ArchiveURL != ""
+}
+
+// fetchArchive downloads and extracts ArchiveURL into the cache, standing in
+// for a clone. The version directory is named after the URL and the
+// server's ETag or Last-Modified, so a changed archive is fetched afresh.
+func (r *Repository) fetchArchive(baseDir string) (string, error) {
+	modified := r.resolveArchiveVersion()
+
+	basePath := filepath.Join(baseDir, r.User, r.Repo, r.archiveVersion)
+	srcPath := filepath.Join(basePath, "src")
+	r.Path = basePath
+
+	if r.ForceClone {
+		if err := removeClone(baseDir, srcPath); err != nil {
+			return "", err
+		}
+	}
+	if _, err := os.Stat(srcPath); err == nil {
+		logger.Printf("Archive already extracted at %s\n", srcPath)
+		return srcPath, nil
+	}
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return "", fmt.Errorf("could not create archive directory: %w", err)
+	}
+	download, err := r.downloadArchive(basePath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(download)
+
+	// Extract beside the final location, so an interrupted run never leaves
+	// a partial src directory that looks complete
+	tmpDir, err := os.MkdirTemp(basePath, "extract-")
+	if err != nil {
+		return "", fmt.Errorf("could not create extraction directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if u, _ := url.Parse(r.ArchiveURL); archiveSuffix(u.Path) == ".zip" {
+		err = r.extractZip(download, tmpDir)
+	} else {
+		err = r.extractTarGz(download, tmpDir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(archiveRoot(tmpDir), srcPath); err != nil {
+		return "", fmt.Errorf("could not move extracted archive into place: %w", err)
+	}
+	if !modified.IsZero() {
+		os.Chtimes(srcPath, modified, modified)
+	}
+	return srcPath, r.enforceSizeLimit(srcPath)
+}
+
+// resolveArchiveVersion sets the synthetic version that stands in for a
+// commit hash, and returns the archive's Last-Modified time if known. The
+// server is asked with a HEAD request; without one, the URL alone names
+// the version.
+func (r *Repository) resolveArchiveVersion() time.Time {
+	key := r.ArchiveURL
+	var modified time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, r.ArchiveURL, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = apiClient.Do(req); err == nil {
+			resp.Body.Close()
+			if etag := resp.Header.Get("ETag"); etag != "" {
+				key += "\netag:" + etag
+			} else if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+				key += "\nmodified:" + lastModified
+			}
+			modified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+		}
+	}
+	if err != nil {
+		logger.Verbosef("Could not check the archive for changes: %v\n", err)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	r.archiveVersion = "archive-" + hex.EncodeToString(sum[:])[:12]
+	return modified
+}
+
+// downloadArchive saves the archive to a temporary file under dir,
+// refusing one larger than MaxRepoSize
+func (r *Repository) downloadArchive(dir string) (string, error) {
+	logger.Printf("Downloading %s...\n", r.ArchiveURL)
+	resp, err := apiClient.Get(r.ArchiveURL)
+	if err != nil {
+		return "", fmt.Errorf("could not download archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download archive: %s", resp.Status)
+	}
+	if r.MaxRepoSize > 0 && resp.ContentLength > r.MaxRepoSize {
+		return "", r.tooLarge(resp.ContentLength)
+	}
+
+	file, err := os.CreateTemp(dir, "download-")
+	if err != nil {
+		return "", fmt.Errorf("could not create download file: %w", err)
+	}
+	defer file.Close()
+
+	body := io.Reader(resp.Body)
+	if r.MaxRepoSize > 0 {
+		body = io.LimitReader(resp.Body, r.MaxRepoSize+1)
+	}
+	n, err := io.Copy(file, body)
+	if err == nil && r.MaxRepoSize > 0 && n > r.MaxRepoSize {
+		err = r.tooLarge(n)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("could not download archive: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// extractTarGz extracts regular files and directories; links and devices
+// are skipped
+func (r *Repository) extractTarGz(archive, dir string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("could not read tarball: %w", err)
+	}
+	defer gz.Close()
+
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read tarball: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			target, err := extractPath(dir, header.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if total, err = r.extractFile(dir, header.Name, tr, total); err != nil {
+				return err
+			}
+		default:
+			logger.Verbosef("Skipping %s in archive: not a regular file\n", header.Name)
+		}
+	}
+}
+
+// extractZip extracts regular files and directories; links are skipped
+func (r *Repository) extractZip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("could not read zip: %w", err)
+	}
+	defer zr.Close()
+
+	var total int64
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			target, err := extractPath(dir, f.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("could not read %s from zip: %w", f.Name, err)
+			}
+			total, err = r.extractFile(dir, f.Name, rc, total)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			logger.Verbosef("Skipping %s in archive: not a regular file\n", f.Name)
+		}
+	}
+	return nil
+}
+
+// extractFile writes one archive entry under dir and returns the running
+// total of extracted bytes, failing once it passes MaxRepoSize so a
+// compressed archive can't expand without bound
+func (r *Repository) extractFile(dir, name string, content io.Reader, total int64) (int64, error) {
+	target, err := extractPath(dir, name)
+	if err != nil {
+		return total, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return total, err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return total, err
+	}
+	defer out.Close()
+
+	if r.MaxRepoSize > 0 {
+		content = io.LimitReader(content, r.MaxRepoSize-total+1)
+	}
+	n, err := io.Copy(out, content)
+	total += n
+	if err != nil {
+		return total, fmt.Errorf("could not extract %s: %w", name, err)
+	}
+	if r.MaxRepoSize > 0 && total > r.MaxRepoSize {
+		return total, r.tooLarge(total)
+	}
+	return total, nil
+}
+
+// extractPath resolves an archive entry name under dir, rejecting names
+// that would escape it
+func extractPath(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to extract %q: outside the archive root", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// archiveRoot returns the directory to document: the single top-level
+// directory most archives wrap their contents in, or dir itself
+func archiveRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name())
+	}
+	return dir
+}
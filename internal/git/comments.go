@@ -0,0 +1,199 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// commentSyntax describes how comments and string literals are written in a
+// language, enough to find comments without mistaking "//" in a string for
+// one
+type commentSyntax struct {
+	line      []string // line comment markers
+	hashAtGap bool     // "#" only starts a comment at line start or after whitespace
+	block     [2]string
+	quotes    string // string delimiters; backslash escapes inside all but `
+}
+
+var (
+	cLike     = commentSyntax{line: []string{"//"}, block: [2]string{"/*", "*/"}, quotes: `"'`}
+	hashStyle = commentSyntax{line: []string{"#"}, hashAtGap: true, quotes: `"'`}
+)
+
+// commentSyntaxes maps languages from languageExtensions to their syntax
+var commentSyntaxes = map[string]commentSyntax{
+	"c":          cLike,
+	"cpp":        cLike,
+	"csharp":     cLike,
+	"go":         {line: []string{"//"}, block: [2]string{"/*", "*/"}, quotes: "\"'`"},
+	"java":       cLike,
+	"javascript": {line: []string{"//"}, block: [2]string{"/*", "*/"}, quotes: "\"'`"},
+	"kotlin":     cLike,
+	"php":        {line: []string{"//", "#"}, block: [2]string{"/*", "*/"}, quotes: `"'`},
+	"python":     hashStyle,
+	"ruby":       hashStyle,
+	"rust":       {line: []string{"//"}, block: [2]string{"/*", "*/"}, quotes: `"`}, // ' also starts lifetimes
+	"scala":      cLike,
+	"shell":      hashStyle,
+	"swift":      cLike,
+	"typescript": {line: []string{"//"}, block: [2]string{"/*", "*/"}, quotes: "\"'`"},
+}
+
+// keptComments are comments that affect the build and so are never stripped
+var keptComments = []string{"//go:", "// +build", "#!"}
+
+// licenseComment matches comment lines that form a license header
+var licenseComment = regexp.MustCompile(`^\s*(//|#|--|;|/\*|\*|\*/|<!--|-->)`)
+
+// StripComments removes comments from source code to save prompt space.
+// Languages in commentSyntaxes lose all their comments, except build
+// directives and shebangs. Other files only lose a leading license header.
+// Documentation files are returned unchanged.
+func StripComments(path, content string) string {
+	if IsDocFile(path) || IsNotebook(path) {
+		return content
+	}
+	syntax, ok := commentSyntaxes[LanguageOf(path)]
+	if !ok {
+		return stripLicenseHeader(content)
+	}
+	return syntax.strip(content)
+}
+
+// strip scans content once, tracking string literals so that comment
+// markers inside them are left alone. Lines left blank by a removed comment
+// are dropped, as are leading and repeated blank lines.
+func (s commentSyntax) strip(content string) string {
+	var out, line strings.Builder
+	hadComment := false
+	lastBlank := true
+	endLine := func() {
+		text := line.String()
+		line.Reset()
+		if hadComment {
+			text = strings.TrimRight(text, " \t")
+			hadComment = false
+			if strings.TrimSpace(text) == "" {
+				return
+			}
+		}
+		blank := strings.TrimSpace(text) == ""
+		if blank && lastBlank {
+			return
+		}
+		lastBlank = blank
+		out.WriteString(text + "\n")
+	}
+
+	quote := "" // the open string's delimiter
+	inBlock := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		rest := content[i:]
+
+		switch {
+		case c == '\n':
+			endLine()
+			// Only raw and triple-quoted strings span lines
+			if quote != "`" && len(quote) != 3 {
+				quote = ""
+			}
+
+		case inBlock:
+			hadComment = true
+			if strings.HasPrefix(rest, s.block[1]) {
+				inBlock = false
+				i += len(s.block[1]) - 1
+			}
+
+		case quote != "":
+			if strings.HasPrefix(rest, quote) {
+				line.WriteString(quote)
+				i += len(quote) - 1
+				quote = ""
+			} else if c == '\\' && quote != "`" && i+1 < len(content) && content[i+1] != '\n' {
+				line.WriteString(rest[:2])
+				i++
+			} else {
+				line.WriteByte(c)
+			}
+
+		case s.block[0] != "" && strings.HasPrefix(rest, s.block[0]):
+			inBlock = true
+			hadComment = true
+			i += len(s.block[0]) - 1
+
+		case strings.IndexByte(s.quotes, c) >= 0:
+			quote = string(c)
+			if triple := strings.Repeat(quote, 3); strings.HasPrefix(rest, triple) {
+				quote = triple
+			}
+			line.WriteString(quote)
+			i += len(quote) - 1
+
+		case s.lineComment(rest, line.String()):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			if kept(rest) {
+				line.WriteString(rest[:end])
+			} else {
+				hadComment = true
+			}
+			i += end - 1
+
+		default:
+			line.WriteByte(c)
+		}
+	}
+	if line.Len() > 0 || hadComment {
+		endLine()
+	}
+
+	result := out.String()
+	if !strings.HasSuffix(content, "\n") {
+		result = strings.TrimSuffix(result, "\n")
+	}
+	return result
+}
+
+// lineComment reports whether a line comment starts at rest, given the
+// text of the line so far
+func (s commentSyntax) lineComment(rest, before string) bool {
+	for _, marker := range s.line {
+		if !strings.HasPrefix(rest, marker) {
+			continue
+		}
+		if marker == "#" && s.hashAtGap && before != "" && !strings.HasSuffix(before, " ") && !strings.HasSuffix(before, "\t") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func kept(comment string) bool {
+	for _, prefix := range keptComments {
+		if strings.HasPrefix(comment, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripLicenseHeader removes a leading run of comment lines that mentions a
+// copyright or license, the only comment that's safe to recognise without
+// knowing the language
+func stripLicenseHeader(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	end := 0
+	for end < len(lines) && licenseComment.MatchString(lines[end]) && !strings.HasPrefix(lines[end], "#!") {
+		end++
+	}
+	header := strings.ToLower(strings.Join(lines[:end], ""))
+	if end == 0 || !strings.Contains(header, "copyright") && !strings.Contains(header, "license") {
+		return content
+	}
+	return strings.TrimLeft(strings.Join(lines[end:], ""), "\n")
+}
@@ -0,0 +1,107 @@
+package git
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// matchGlob reports whether a slash-separated relative path matches a glob
+// pattern. In addition to the usual * and ? wildcards, ** matches across
+// directories. Patterns without a slash are matched against the base name,
+// so "*.md" matches markdown files at any depth.
+func matchGlob(pattern, path string) bool {
+	path = filepath.ToSlash(path)
+	if !strings.Contains(pattern, "/") {
+		path = filepath.Base(path)
+	}
+
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
+
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// testFilePatterns recognize test files by common naming conventions
+var testFilePatterns = []string{
+	"*_test.go",
+	"test_*.py",
+	"*_test.py",
+	"*.spec.ts", "*.spec.tsx", "*.spec.js", "*.spec.jsx",
+	"*.test.ts", "*.test.tsx", "*.test.js", "*.test.jsx",
+	"*_spec.rb",
+	"**/__tests__/**",
+}
+
+func isTestFile(path string) bool {
+	return matchAny(testFilePatterns, path)
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded applies the skip list, the repository's include/exclude globs
+// and language allowlist to a relative path. Precedence, lowest first:
+//
+//  1. DefaultSkip drops lockfiles and vendored dependencies
+//  2. IgnoreFileName rules, where the last match wins and !pattern re-includes
+//  3. !pattern entries in Include re-include skipped paths
+//  4. other Include entries, if any, form an allowlist
+//  5. Exclude always removes a path
+//
+// Documentation files are kept regardless of the language allowlist. Test
+// files are dropped unless IncludeTests is set.
+func (r *Repository) isIncluded(relPath string) bool {
+	if !r.IncludeTests && isTestFile(relPath) {
+		return false
+	}
+	if r.isSkipped(relPath) {
+		return false
+	}
+	if include, _ := splitNegations(r.Include); len(include) > 0 && !matchAny(include, relPath) {
+		return false
+	}
+	if matchAny(r.Exclude, relPath) {
+		return false
+	}
+	if len(r.Languages) > 0 && !IsDocFile(relPath) && !matchesLanguages(r.Languages, relPath) {
+		return false
+	}
+	return true
+}
@@ -2,27 +2,73 @@ package git
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/boyter/gocodewalker"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/johnknott/repocontext/internal/logger"
 )
 
 type Repository struct {
-	User string
-	Repo string
-	Tag  string
-	Path string
+	User         string
+	Repo         string
+	Tag          string
+	Branch       string // branch to document instead of the default branch
+	Commit       string // full commit SHA to document, see SetCommit
+	ArchiveURL   string // tarball or zip to download instead of cloning, see IsArchiveURL
+	Path         string
+	BaseDir      string   // cache root for clones (default ~/.repocontext)
+	Subpath      string   // subdirectory to document, relative to the repo root
+	Include      []string // globs a file must match to be documented (empty = all); !glob re-includes skipped files
+	Exclude      []string // globs that remove files from documentation
+	Languages    []string // if set, only source files in these languages (plus docs)
+	IncludeTests bool     // keep files that look like tests
+	SLOCStrict   bool     // skip blank and comment-only lines when counting lines
+	Strip        bool     // size files as they are with comments stripped, see StripComments
+	ForceClone   bool     // discard any existing clone and clone afresh
+	MaxRepoSize  int64    // refuse checkouts larger than this many bytes (0 = no limit)
+	Strict       bool     // fail on a file that can't be read or classified instead of skipping it
+	TruncateSize int64    // size text files larger than this at this size, as TruncateContent will cut them (0 = off)
+	History      int      // commits of history to fetch; 0 or 1 is a shallow clone
+	Proxy        string   // HTTP proxy for the system git used by partial clones
+
+	// Binary detection tuning; zero values use the defaults below
+	EntropyThreshold float64  // bits per byte above which content is binary
+	TextRatio        float64  // minimum share of text characters for text files
+	ForceText        []string // globs of files always treated as text
+
+	ignoreRules []ignoreRule     // from IgnoreFileName, loaded by GetFiles
+	binaries    map[string]int64 // binary files skipped by GetFiles, path -> size
+	moved       bool             // already retried at a renamed location
+
+	archiveVersion string // stands in for the commit hash of an archive
 }
 
+const (
+	DefaultEntropyThreshold = 7.0
+	DefaultTextRatio        = 0.7
+)
+
 type RepoFile struct {
 	Path    string
 	Size    int64
+	Lines   int
 	Content string
 }
 
@@ -40,21 +86,27 @@ var binarySignatures = [][]byte{
 }
 
 // isBinaryFile checks if a file is binary using multiple heuristics
-func isBinaryFile(path string) (bool, error) {
+func (r *Repository) isBinaryFile(path string) (bool, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return false, err
 	}
 	defer file.Close()
 
-	// Read first 512 bytes for analysis
+	// Read first 512 bytes for analysis. ReadFull keeps reading past short
+	// reads, and reports a file shorter than the buffer as an EOF error.
 	buf := make([]byte, 512)
-	n, err := file.Read(buf)
-	if err != nil && err.Error() != "EOF" {
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return false, err
 	}
 	buf = buf[:n]
 
+	// An empty file has nothing binary about it
+	if n == 0 {
+		return false, nil
+	}
+
 	// 1. Check file signatures
 	for _, signature := range binarySignatures {
 		if bytes.HasPrefix(buf, signature) {
@@ -69,8 +121,12 @@ func isBinaryFile(path string) (bool, error) {
 
 	// 3. Calculate entropy of the content
 	// High entropy often indicates compression or encryption
+	entropyThreshold := r.EntropyThreshold
+	if entropyThreshold == 0 {
+		entropyThreshold = DefaultEntropyThreshold
+	}
 	entropy := calculateEntropy(buf)
-	if entropy > 7.0 {
+	if entropy > entropyThreshold {
 		return true, nil
 	}
 
@@ -83,8 +139,12 @@ func isBinaryFile(path string) (bool, error) {
 		}
 	}
 
-	// If less than 70% of content is text characters, likely binary
-	if float64(textChars)/float64(len(buf)) < 0.7 {
+	// If too little of the content is text characters, likely binary
+	textRatio := r.TextRatio
+	if textRatio == 0 {
+		textRatio = DefaultTextRatio
+	}
+	if float64(textChars)/float64(len(buf)) < textRatio {
 		return true, nil
 	}
 
@@ -113,109 +173,437 @@ func calculateEntropy(data []byte) float64 {
 	return entropy
 }
 
+// UseHTTPClient makes all git HTTP(S) operations go through httpClient,
+// e.g. to route clones via a proxy.
+func UseHTTPClient(httpClient *http.Client) {
+	apiClient = httpClient
+	transport := githttp.NewClient(httpClient)
+	client.InstallProtocol("https", transport)
+	client.InstallProtocol("http", transport)
+}
+
+// commitHashPattern matches a full hex commit SHA
+var commitHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// IsCommitHash reports whether ref looks like a full commit SHA rather than
+// a tag name
+func IsCommitHash(ref string) bool {
+	return commitHashPattern.MatchString(ref)
+}
+
 func ParseRepoPath(path string) (*Repository, error) {
+	if IsArchiveURL(path) {
+		return parseArchiveURL(path)
+	}
+
+	subpath := ""
+	if idx := strings.Index(path, ":"); idx != -1 {
+		path, subpath = path[:idx], path[idx+1:]
+	}
+
+	branch := ""
+	if idx := strings.Index(path, "#"); idx != -1 {
+		path, branch = path[:idx], path[idx+1:]
+	}
+
 	parts := strings.Split(path, "@")
 	repoPath := parts[0]
 	tag := ""
 	if len(parts) > 1 {
 		tag = parts[1]
 	}
+	if tag != "" && branch != "" {
+		return nil, fmt.Errorf("invalid repository path: give either @tag or #branch, not both")
+	}
 
 	repoParts := strings.Split(repoPath, "/")
 	if len(repoParts) != 2 {
-		return nil, fmt.Errorf("invalid repository path format. Expected user/repo[@tag]")
+		return nil, fmt.Errorf("invalid repository path format. Expected user/repo[@tag|@commit|#branch][:subpath]")
 	}
 
-	return &Repository{
-		User: repoParts[0],
-		Repo: repoParts[1],
-		Tag:  tag,
-	}, nil
+	repo := &Repository{
+		User:   repoParts[0],
+		Repo:   repoParts[1],
+		Branch: branch,
+	}
+	if IsCommitHash(tag) {
+		repo.Commit = strings.ToLower(tag)
+	} else {
+		repo.Tag = tag
+	}
+	if err := repo.SetSubpath(subpath); err != nil {
+		return nil, err
+	}
+	return repo, nil
 }
 
-func (r *Repository) Clone() (string, error) {
+// SetCommit pins the repository to a commit, given as a full 40-character
+// SHA. Abbreviated hashes are rejected since they can't be fetched directly.
+func (r *Repository) SetCommit(sha string) error {
+	if !IsCommitHash(sha) {
+		return fmt.Errorf("invalid commit %q: expected a full 40-character SHA", sha)
+	}
+	if r.Tag != "" || r.Branch != "" {
+		return fmt.Errorf("a commit cannot be combined with @tag or #branch")
+	}
+	r.Commit = strings.ToLower(sha)
+	return nil
+}
+
+// SetSubpath restricts documentation to a subdirectory of the repository
+func (r *Repository) SetSubpath(subpath string) error {
+	if subpath == "" {
+		r.Subpath = ""
+		return nil
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(subpath))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid subpath %q: must be relative to the repository root", subpath)
+	}
+	if cleaned == "." {
+		cleaned = ""
+	}
+
+	r.Subpath = cleaned
+	return nil
+}
+
+// DefaultBaseDir returns the default cache root, ~/.repocontext
+func DefaultBaseDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("could not get home directory: %w", err)
 	}
+	return filepath.Join(homeDir, ".repocontext"), nil
+}
 
-	// Use tag if provided, otherwise use "main"
-	versionIdentifier := "main"
-	if r.Tag != "" {
-		versionIdentifier = r.Tag
+func (r *Repository) Clone(ctx context.Context) (string, error) {
+	baseDir := r.BaseDir
+	if baseDir == "" {
+		var err error
+		if baseDir, err = DefaultBaseDir(); err != nil {
+			return "", err
+		}
+	}
+	if r.IsArchive() {
+		return r.fetchArchive(baseDir)
 	}
 
 	// Full path including version
-	basePath := filepath.Join(homeDir, ".repocontext", r.User, r.Repo, versionIdentifier)
+	basePath := filepath.Join(baseDir, r.User, r.Repo, r.versionIdentifier())
 	srcPath := filepath.Join(basePath, "src")
 	r.Path = basePath
 
+	cloneURL := fmt.Sprintf("https://github.com/%s/%s.git", r.User, r.Repo)
+
+	if r.ForceClone {
+		if err := removeClone(baseDir, srcPath); err != nil {
+			return "", err
+		}
+	}
+
 	// Check if repository already exists
 	if _, err := os.Stat(srcPath); err == nil {
-		fmt.Printf("Repository exists at %s, updating...\n", srcPath)
 		repo, err := git.PlainOpen(srcPath)
-		if err != nil {
-			return "", fmt.Errorf("failed to open repository: %w", err)
+		switch {
+		case err != nil:
+			// Not a usable repository, e.g. an empty directory or a broken .git
+			if err != git.ErrRepositoryNotExists {
+				logger.Warnf("removing unrecoverable clone at %s: %v\n", srcPath, err)
+			}
+			if err := os.RemoveAll(srcPath); err != nil {
+				return "", fmt.Errorf("could not remove broken clone: %w", err)
+			}
+		case isPartial(repo):
+			logger.Printf("Repository exists at %s (partial clone), updating...\n", srcPath)
+			if err := r.updatePartial(ctx, srcPath); err != nil {
+				return "", fmt.Errorf("%w (rerun to resume the clone)", err)
+			}
+			return srcPath, r.enforceSizeLimit(srcPath)
+		case cloneIncomplete(srcPath):
+			logger.Printf("Resuming incomplete clone at %s...\n", srcPath)
+			if err := r.completeCloneWithRetry(ctx, repo, srcPath); err != nil {
+				return "", fmt.Errorf("%w (rerun to resume the clone)", err)
+			}
+			return srcPath, r.enforceSizeLimit(srcPath)
+		case r.Commit != "":
+			// A pinned commit never changes, so there's nothing to pull, but an
+			// earlier run may have checked out a different subpath
+			logger.Printf("Repository exists at %s (commit %s)\n", srcPath, r.Commit[:12])
+			if err := r.matchCheckout(repo); err != nil {
+				return "", err
+			}
+			return srcPath, nil
+		default:
+			logger.Printf("Repository exists at %s, updating...\n", srcPath)
+			if err := r.update(ctx, repo); err != nil {
+				return "", err
+			}
+			return srcPath, nil
 		}
+	}
 
-		// Get the worktree
-		w, err := repo.Worktree()
-		if err != nil {
-			return "", fmt.Errorf("failed to get worktree: %w", err)
+	// The API only knows the whole repository's size, so a sparse checkout
+	// of a subdirectory is measured after cloning instead
+	if r.MaxRepoSize > 0 && r.Subpath == "" {
+		if err := r.checkRemoteSize(); err != nil {
+			return "", err
 		}
+	}
 
-		// Pull the latest changes
-		err = w.Pull(&git.PullOptions{
-			Force:      true,
-			RemoteName: "origin",
-		})
-		if err != nil && err != git.NoErrAlreadyUpToDate {
-			return "", fmt.Errorf("failed to pull repository: %w", err)
+	// Only a subdirectory's files are needed, so fetch just those when the
+	// system git and the server allow it
+	if r.Subpath != "" {
+		partial, err := r.partialClone(ctx, srcPath, cloneURL)
+		if err != nil {
+			return "", fmt.Errorf("could not clone repository: %w (rerun to resume the clone)", err)
+		}
+		if partial {
+			return srcPath, r.enforceSizeLimit(srcPath)
 		}
-
-		return srcPath, nil
 	}
 
-	// Clone new repository
+	// Clone new repository. A failure after init leaves the partial clone in
+	// place so the next run can resume it.
 	if err := os.MkdirAll(srcPath, 0755); err != nil {
 		return "", fmt.Errorf("could not create repository directory: %w", err)
 	}
 
-	url := fmt.Sprintf("https://github.com/%s/%s.git", r.User, r.Repo)
-	_, err = git.PlainClone(srcPath, false, &git.CloneOptions{
-		URL:      url,
-		Progress: os.Stdout,
-		Depth:    1,
-	})
+	start := time.Now()
+	repo, err := r.initClone(srcPath, cloneURL)
 	if err != nil {
 		os.RemoveAll(srcPath)
-		return "", fmt.Errorf("could not clone repository: %w", err)
+		return "", err
+	}
+	if err := r.completeCloneWithRetry(ctx, repo, srcPath); err != nil {
+		if isNotFound(err) {
+			os.RemoveAll(srcPath)
+			return r.cloneMoved(ctx, err)
+		}
+		return "", fmt.Errorf("could not clone repository: %w (rerun to resume the clone)", err)
 	}
 
-	return srcPath, nil
+	if logger.IsVerbose() {
+		logger.Verbosef("Cloned in %s (%d objects)\n", time.Since(start).Round(time.Millisecond), countObjects(repo))
+	}
+
+	return srcPath, r.enforceSizeLimit(srcPath)
+}
+
+// versionIdentifier names the directory a clone is cached in: the tag,
+// branch or commit if provided, otherwise "main". Branches and commits get a
+// prefix so they can't collide with a tag of the same name, and ref names
+// are path-escaped so that a slash doesn't nest directories and distinct
+// names never share one.
+func (r *Repository) versionIdentifier() string {
+	switch {
+	case r.Commit != "":
+		return "commit-" + r.Commit
+	case r.Tag != "":
+		return url.PathEscape(r.Tag)
+	case r.Branch != "":
+		return "branch-" + url.PathEscape(r.Branch)
+	}
+	return "main"
 }
 
+// enforceSizeLimit removes a fresh checkout that exceeds MaxRepoSize
+func (r *Repository) enforceSizeLimit(srcPath string) error {
+	if r.MaxRepoSize <= 0 {
+		return nil
+	}
+	if err := r.checkCheckoutSize(); err != nil {
+		if rmErr := os.RemoveAll(srcPath); rmErr != nil {
+			logger.Warnf("could not remove oversized clone at %s: %v\n", srcPath, rmErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// removeClone deletes a clone for --force-clone, refusing to touch anything
+// outside the cache root.
+func removeClone(baseDir, srcPath string) error {
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return fmt.Errorf("could not resolve cache directory: %w", err)
+	}
+	absSrc, err := filepath.Abs(srcPath)
+	if err != nil {
+		return fmt.Errorf("could not resolve clone directory: %w", err)
+	}
+	rel, err := filepath.Rel(absBase, absSrc)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to remove %s: not inside the cache directory %s", absSrc, absBase)
+	}
+
+	if _, err := os.Stat(absSrc); os.IsNotExist(err) {
+		return nil
+	}
+	logger.Printf("Removing existing clone at %s...\n", absSrc)
+	if err := os.RemoveAll(absSrc); err != nil {
+		return fmt.Errorf("could not remove existing clone: %w", err)
+	}
+	return nil
+}
+
+// update pulls the latest changes into an existing clone. A tag is fetched
+// again and checked out, in case it was moved.
+func (r *Repository) update(ctx context.Context, repo *git.Repository) error {
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	// Pull works on a full worktree; re-apply the sparse checkout after
+	if isSparse(repo) {
+		if err := restoreFullCheckout(repo, w); err != nil {
+			return err
+		}
+	}
+
+	if r.Tag != "" {
+		remote, err := repo.Remote("origin")
+		if err != nil {
+			return fmt.Errorf("failed to get origin remote: %w", err)
+		}
+		hash, err := r.fetchTag(ctx, repo, remote)
+		if err != nil {
+			return err
+		}
+		return r.checkoutDetached(repo, hash, "tag "+r.Tag)
+	}
+
+	opts := &git.PullOptions{
+		Force:      true,
+		RemoteName: "origin",
+		Progress:   logger.ProgressWriter(),
+	}
+	if r.Branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(r.Branch)
+		opts.SingleBranch = true
+	}
+	if r.History > 1 {
+		opts.Depth = r.History
+	}
+	err = w.Pull(opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to pull repository: %w", err)
+	}
+
+	if r.Subpath != "" {
+		return r.checkoutSparse(repo)
+	}
+	return nil
+}
+
+// countObjects returns the number of objects in the repository's object store
+func countObjects(repo *git.Repository) int {
+	iter, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return 0
+	}
+	defer iter.Close()
+
+	count := 0
+	iter.ForEach(func(plumbing.EncodedObject) error {
+		count++
+		return nil
+	})
+	return count
+}
+
+// SrcPath returns the directory holding the checked-out sources
+func (r *Repository) SrcPath() string {
+	return filepath.Join(r.Path, "src")
+}
+
+// RootPath returns the directory being documented: the checkout itself, or
+// the configured subdirectory within it.
+func (r *Repository) RootPath() string {
+	return filepath.Join(r.SrcPath(), r.Subpath)
+}
+
+// ValidateSubpath checks that the configured subdirectory exists in the checkout
+func (r *Repository) ValidateSubpath() error {
+	if r.Subpath == "" {
+		return nil
+	}
+
+	info, err := os.Stat(r.RootPath())
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("subpath %q does not exist in %s/%s", filepath.ToSlash(r.Subpath), r.User, r.Repo)
+	}
+	return nil
+}
+
+// GetFiles lists documentable files under RootPath, keyed by path relative to it
 func (r *Repository) GetFiles() (map[string]*RepoFile, error) {
 	fileListQueue := make(chan *gocodewalker.File, 100)
 	files := make(map[string]*RepoFile)
+	srcPath := r.RootPath()
 
-	fileWalker := gocodewalker.NewFileWalker(r.Path, fileListQueue)
+	rules, err := loadIgnoreFile(filepath.Join(srcPath, IgnoreFileName))
+	if err != nil {
+		return nil, err
+	}
+	r.ignoreRules = rules
+	r.binaries = make(map[string]int64)
+
+	fileWalker := gocodewalker.NewFileWalker(srcPath, fileListQueue)
+
+	// The first problem fails the listing when strict. The walker may report
+	// errors from several goroutines.
+	var problemMu sync.Mutex
+	var problem error
+	report := func(format string, args ...any) {
+		if err := logger.Problemf(r.Strict, format, args...); err != nil {
+			problemMu.Lock()
+			if problem == nil {
+				problem = err
+			}
+			problemMu.Unlock()
+		}
+	}
+	failed := func() bool {
+		problemMu.Lock()
+		defer problemMu.Unlock()
+		return problem != nil
+	}
 
-	// Error handler that continues on error
+	// Error handler that continues on error, unless strict
 	errorHandler := func(e error) bool {
-		fmt.Fprintf(os.Stderr, "Warning: %v\n", e)
-		return true
+		report("%v\n", e)
+		return !failed()
 	}
 	fileWalker.SetErrorHandler(errorHandler)
 
 	// Start walking in a goroutine
 	go fileWalker.Start()
 
-	// Collect files
+	// Collect files, draining the queue after a strict failure so the walker
+	// can finish
 	for f := range fileListQueue {
+		if failed() {
+			continue
+		}
+
+		// Get relative path
+		relPath, err := filepath.Rel(srcPath, f.Location)
+		if err != nil {
+			report("could not resolve %s: %v\n", f.Location, err)
+			continue
+		}
+
+		if !r.isIncluded(relPath) {
+			continue
+		}
+
 		// Get file info
 		info, err := os.Stat(f.Location)
 		if err != nil {
+			report("could not stat %s: %v\n", f.Location, err)
 			continue
 		}
 
@@ -224,36 +612,73 @@ func (r *Repository) GetFiles() (map[string]*RepoFile, error) {
 			continue
 		}
 
-		// Check if file is binary
-		isBinary, err := isBinaryFile(f.Location)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Could not check if file is binary %s: %v\n", f.Location, err)
-			continue
+		// Notebooks are JSON whose embedded outputs can look binary; they're
+		// listed by their cells instead, unless they can't be parsed
+		if IsNotebook(relPath) {
+			file, err := readNotebook(f.Location, relPath)
+			if err == nil {
+				files[relPath] = file
+				continue
+			}
+			logger.Verbosef("Reading %s as plain JSON: %v\n", relPath, err)
 		}
 
-		if isBinary {
-			continue
+		// Check if file is binary, unless forced to be text
+		if !matchAny(r.ForceText, relPath) {
+			isBinary, err := r.isBinaryFile(f.Location)
+			if err != nil {
+				report("could not check if file is binary %s: %v\n", f.Location, err)
+				continue
+			}
+
+			if isBinary {
+				r.binaries[relPath] = info.Size()
+				continue
+			}
 		}
 
-		// Get relative path
-		relPath, err := filepath.Rel(r.Path, f.Location)
+		lines, err := countLines(f.Location, r.SLOCStrict)
 		if err != nil {
-			continue
+			report("could not count lines in %s: %v\n", f.Location, err)
+		}
+
+		// Stripped files are budgeted at the size that reaches the prompt
+		size := info.Size()
+		if r.Strip {
+			data, err := os.ReadFile(f.Location)
+			if err != nil {
+				report("could not read %s: %v\n", f.Location, err)
+				continue
+			}
+			size = int64(len(StripComments(relPath, string(data))))
+		}
+		if r.TruncateSize > 0 && size > r.TruncateSize {
+			size = r.TruncateSize
 		}
 
 		files[relPath] = &RepoFile{
-			Path: relPath,
-			Size: info.Size(),
+			Path:  relPath,
+			Size:  size,
+			Lines: lines,
 		}
 	}
 
+	if problem != nil {
+		return nil, problem
+	}
 	return files, nil
 }
 
+// BinaryFiles returns the included files GetFiles skipped as binary, keyed
+// by relative path with their sizes. Only their names are ever documented.
+func (r *Repository) BinaryFiles() map[string]int64 {
+	return r.binaries
+}
+
 // ReadFileContents reads the actual content of selected files
 func (r *Repository) ReadFileContents(files map[string]*RepoFile) error {
 	for _, file := range files {
-		content, err := ioutil.ReadFile(filepath.Join(r.Path, file.Path))
+		content, err := ioutil.ReadFile(filepath.Join(r.RootPath(), file.Path))
 		if err != nil {
 			return fmt.Errorf("failed to read file %s: %w", file.Path, err)
 		}
@@ -263,16 +688,75 @@ func (r *Repository) ReadFileContents(files map[string]*RepoFile) error {
 }
 
 func (r *Repository) GetCurrentCommitHash() (string, error) {
-	srcPath := filepath.Join(r.Path, "src")
-	repo, err := git.PlainOpen(srcPath)
+	if r.IsArchive() {
+		return r.archiveVersion, nil
+	}
+
+	repo, err := git.PlainOpen(r.SrcPath())
 	if err != nil {
 		return "", fmt.Errorf("failed to open repository: %w", err)
 	}
 
+	hash, err := r.resolveHead(repo)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// resolveHead returns the commit HEAD points at. If HEAD is broken, e.g. it
+// names a branch an interrupted update never wrote, the pinned commit, tag or
+// remote branch the clone was made from is used instead.
+func (r *Repository) resolveHead(repo *git.Repository) (plumbing.Hash, error) {
 	head, err := repo.Head()
+	if err == nil {
+		return head.Hash(), nil
+	}
+
+	var fallback plumbing.Revision
+	switch {
+	case r.Commit != "":
+		fallback = plumbing.Revision(r.Commit)
+	case r.Tag != "":
+		fallback = plumbing.Revision(plumbing.NewTagReferenceName(r.Tag))
+	case r.Branch != "":
+		fallback = plumbing.Revision(plumbing.NewRemoteReferenceName("origin", r.Branch))
+	}
+	if fallback != "" {
+		if hash, resolveErr := repo.ResolveRevision(fallback); resolveErr == nil {
+			logger.Verbosef("HEAD is unusable (%v), using %s\n", err, fallback)
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("could not resolve HEAD in %s: %w (delete the directory to clone again)", r.SrcPath(), err)
+}
+
+// GetLatestCommitTime returns the committer time of the checked-out HEAD.
+// For an archive it's the archive's Last-Modified time, or when it was
+// downloaded.
+func (r *Repository) GetLatestCommitTime() (time.Time, error) {
+	if r.IsArchive() {
+		info, err := os.Stat(r.SrcPath())
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+
+	repo, err := git.PlainOpen(r.SrcPath())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	hash, err := r.resolveHead(repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	commit, err := repo.CommitObject(hash)
 	if err != nil {
-		return "", fmt.Errorf("failed to get HEAD reference: %w", err)
+		return time.Time{}, fmt.Errorf("failed to read HEAD commit: %w", err)
 	}
 
-	return head.Hash().String(), nil
+	return commit.Committer.When, nil
 }
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestIsBinaryFile(t *testing.T) {
+	text := []byte("package main\n\nfunc main() {}\n")
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"empty", nil, false},
+		{"short text", text, false},
+		{"short with zero byte", []byte("abc\x00def"), true},
+		{"short PNG", []byte("\x89PNG\r\n\x1a\n"), true},
+		{"exactly 512 bytes of text", bytes.Repeat([]byte("abcdefgh"), 64), false},
+		{"exactly 512 bytes with zero byte", append(bytes.Repeat([]byte("a"), 511), 0), true},
+		{"longer than 512 bytes", bytes.Repeat(text, 40), false},
+	}
+
+	dir := t.TempDir()
+	r := &Repository{}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i)))
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.isBinaryFile(path)
+			if err != nil {
+				t.Fatalf("isBinaryFile: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isBinaryFile(%d bytes) = %v, want %v", len(tt.content), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHeadFallback(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit, err := w.Commit("initial", &git.CommitOptions{Author: sig, AllowEmptyCommits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v1", commit, &git.CreateTagOptions{Tagger: sig, Message: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	remoteRef := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "feature/x"), commit)
+	if err := repo.Storer.SetReference(remoteRef); err != nil {
+		t.Fatal(err)
+	}
+	// HEAD names a branch that was never written
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		r       *Repository
+		wantErr bool
+	}{
+		{"pinned commit", &Repository{Commit: commit.String()}, false},
+		{"annotated tag", &Repository{Tag: "v1"}, false},
+		{"branch", &Repository{Branch: "feature/x"}, false},
+		{"default branch", &Repository{}, true},
+		{"missing tag", &Repository{Tag: "v2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.r.resolveHead(repo)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveHead = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != commit {
+				t.Errorf("resolveHead = %s, %v; want %s", got, err, commit)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// githubAPI is the base URL used to look up repository details
+var githubAPI = "https://api.github.com"
+
+// apiClient makes GitHub API requests; UseHTTPClient replaces it
+var apiClient = http.DefaultClient
+
+const apiTimeout = 10 * time.Second
+
+// repoInfo is the part of the GitHub repository API response we use
+type repoInfo struct {
+	FullName string `json:"full_name"` // owner/name after any rename or transfer
+	Size     int64  `json:"size"`      // kilobytes
+}
+
+// lookupRepo fetches repository details from the GitHub API. The API
+// redirects renamed and transferred repositories, which the client follows.
+func (r *Repository) lookupRepo() (*repoInfo, error) {
+	var info repoInfo
+	if err := getAPI(context.Background(), fmt.Sprintf("/repos/%s/%s", r.User, r.Repo), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// treeInfo is the part of the GitHub git trees API response we use
+type treeInfo struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"` // the tree was too large to list in full
+}
+
+// lookupTreeSizes fetches the size of every file in a commit's tree from the
+// GitHub API, keyed by slash-separated path. It's used where the blobs
+// themselves were never downloaded.
+func (r *Repository) lookupTreeSizes(ctx context.Context, commit string) (map[string]int64, error) {
+	var info treeInfo
+	if err := getAPI(ctx, fmt.Sprintf("/repos/%s/%s/git/trees/%s?recursive=1", r.User, r.Repo, commit), &info); err != nil {
+		return nil, err
+	}
+	if info.Truncated {
+		return nil, errors.New("tree too large for the GitHub API to list")
+	}
+	sizes := make(map[string]int64, len(info.Tree))
+	for _, entry := range info.Tree {
+		if entry.Type == "blob" {
+			sizes[entry.Path] = entry.Size
+		}
+	}
+	return sizes, nil
+}
+
+// getAPI decodes the JSON response to a GitHub API request for path into v
+func getAPI(ctx context.Context, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse GitHub API response: %w", err)
+	}
+	return nil
+}
+
+// isNotFound reports whether a clone failed because the repository wasn't
+// found. GitHub answers anonymous requests for missing repositories with an
+// authentication challenge, so that counts too.
+func isNotFound(err error) bool {
+	return errors.Is(err, transport.ErrRepositoryNotFound) || errors.Is(err, transport.ErrAuthenticationRequired)
+}
+
+// cloneMoved handles a repository that wasn't found: if the GitHub API
+// reports that it was renamed or transferred, the clone is retried once at
+// the new location. Otherwise the error suggests what may have happened.
+func (r *Repository) cloneMoved(ctx context.Context, cloneErr error) (string, error) {
+	notFound := fmt.Errorf("repository %s/%s not found; it may have been renamed, transferred, deleted or made private: %w", r.User, r.Repo, cloneErr)
+	if r.moved {
+		return "", notFound
+	}
+
+	info, err := r.lookupRepo()
+	if err != nil {
+		logger.Verbosef("Could not look up %s/%s: %v\n", r.User, r.Repo, err)
+		return "", notFound
+	}
+	user, repo, ok := strings.Cut(info.FullName, "/")
+	if !ok || strings.EqualFold(info.FullName, r.User+"/"+r.Repo) {
+		return "", notFound
+	}
+
+	logger.Printf("%s/%s has moved to %s, cloning from there...\n", r.User, r.Repo, info.FullName)
+	r.User, r.Repo = user, repo
+	r.moved = true
+	return r.Clone(ctx)
+}
@@ -0,0 +1,146 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// RecentCommits returns up to n commit messages reachable from HEAD, newest
+// first, each prefixed with its short hash and date. A shallow clone ends the
+// log early, so fewer commits than were asked for can come back.
+func (r *Repository) RecentCommits(n int) ([]string, error) {
+	if r.IsArchive() {
+		return nil, errNoHistory
+	}
+	repo, err := git.PlainOpen(r.SrcPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	hash, err := r.resolveHead(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	defer iter.Close()
+
+	var commits []string
+	err = iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, fmt.Sprintf("%s %s %s",
+			c.Hash.String()[:7], c.Committer.When.Format("2006-01-02"), strings.TrimSpace(c.Message)))
+		if len(commits) == n {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	// The parents of a shallow clone's oldest commit were never fetched
+	if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	return commits, nil
+}
+
+// Author is a commit author
+type Author struct {
+	Name  string
+	Email string
+}
+
+// FileAuthors returns the distinct authors of the most recent commits
+// touching each of paths, most recent first and at most perFile each. Paths
+// are relative to RootPath. History is read once, up to n commits back from
+// HEAD; a path with no change in that window is left out.
+func (r *Repository) FileAuthors(paths []string, n, perFile int) (map[string][]Author, error) {
+	if r.IsArchive() {
+		return nil, errNoHistory
+	}
+	repo, err := git.PlainOpen(r.SrcPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+	hash, err := r.resolveHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	defer iter.Close()
+
+	// Commits name paths from the repository root, not the subpath
+	wanted := make(map[string]string, len(paths))
+	for _, p := range paths {
+		wanted[filepath.ToSlash(filepath.Join(r.Subpath, p))] = p
+	}
+
+	authors := make(map[string][]Author)
+	seen := 0
+	err = iter.ForEach(func(c *object.Commit) error {
+		if seen++; seen > n {
+			return storer.ErrStop
+		}
+		changed, err := changedPaths(c)
+		if err != nil {
+			return err
+		}
+		author := Author{Name: c.Author.Name, Email: c.Author.Email}
+		for _, name := range changed {
+			p, ok := wanted[name]
+			if !ok || len(authors[p]) >= perFile || slices.Contains(authors[p], author) {
+				continue
+			}
+			authors[p] = append(authors[p], author)
+		}
+		return nil
+	})
+	// The parents of a shallow clone's oldest commit were never fetched
+	if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	return authors, nil
+}
+
+// changedPaths lists the files a commit changed relative to its first
+// parent, or every file for a root commit
+func changedPaths(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.To.Name != "" {
+			paths = append(paths, change.To.Name)
+		} else {
+			paths = append(paths, change.From.Name)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// DedupeIdentical removes byte-identical copies from files, keeping the
+// first path in sorted order as the representative. It returns each
+// representative's removed copies. Only files that share a size are hashed.
+func (r *Repository) DedupeIdentical(files map[string]*RepoFile) map[string][]string {
+	bySize := make(map[int64][]string)
+	for path, file := range files {
+		bySize[file.Size] = append(bySize[file.Size], path)
+	}
+
+	identical := make(map[string][]string)
+	for _, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+
+		byHash := make(map[[sha256.Size]byte]string)
+		for _, path := range paths {
+			sum, err := hashFile(filepath.Join(r.RootPath(), path))
+			if err != nil {
+				logger.Verbosef("Could not hash %s: %v\n", path, err)
+				continue
+			}
+			if first, ok := byHash[sum]; ok {
+				identical[first] = append(identical[first], path)
+				delete(files, path)
+				continue
+			}
+			byHash[sum] = path
+		}
+	}
+	return identical
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
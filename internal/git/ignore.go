@@ -0,0 +1,119 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName lists extra paths to skip, one glob per line, in the
+// directory being documented. Lines starting with ! re-include paths.
+const IgnoreFileName = ".repocontextignore"
+
+// DefaultSkip are lockfiles and vendored dependencies, which rarely help
+// explain a project. Negations can pull specific paths back in.
+var DefaultSkip = []string{
+	"**/vendor/**",
+	"**/node_modules/**",
+	"**/third_party/**",
+	"package-lock.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"go.sum",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"poetry.lock",
+	"Pipfile.lock",
+	"composer.lock",
+}
+
+// ignoreRule is one line of an ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	anchored bool // matched against the whole path, even without a slash
+}
+
+func (rule ignoreRule) matches(relPath string) bool {
+	if rule.anchored && !strings.Contains(rule.pattern, "/") {
+		re, err := globToRegexp(rule.pattern)
+		return err == nil && re.MatchString(filepath.ToSlash(relPath))
+	}
+	return matchGlob(rule.pattern, relPath)
+}
+
+// parseIgnoreRule converts a .dockerignore-style line into a glob. A leading
+// / anchors the pattern to the root, and a trailing / matches everything in
+// the directory; a bare directory name matches at any depth.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	rule.pattern, rule.negate = strings.CutPrefix(line, "!")
+	if dir, ok := strings.CutSuffix(rule.pattern, "/"); ok {
+		if !strings.Contains(dir, "/") {
+			dir = "**/" + dir
+		}
+		rule.pattern = dir + "/**"
+	}
+	rule.pattern, rule.anchored = strings.CutPrefix(rule.pattern, "/")
+	return rule, rule.pattern != ""
+}
+
+// loadIgnoreFile reads the rules in an ignore file, ignoring a missing file
+func loadIgnoreFile(path string) ([]ignoreRule, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFileName, err)
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFileName, err)
+	}
+	return rules, nil
+}
+
+// splitNegations separates !patterns from a glob list, e.g. Include
+func splitNegations(patterns []string) (positive, negated []string) {
+	for _, pattern := range patterns {
+		if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+			negated = append(negated, rest)
+		} else {
+			positive = append(positive, pattern)
+		}
+	}
+	return positive, negated
+}
+
+// isSkipped applies DefaultSkip and then the ignore file rules in order, so
+// the last matching rule wins and a ! rule re-includes a path. A !pattern in
+// Include re-includes paths after both.
+func (r *Repository) isSkipped(relPath string) bool {
+	skip := matchAny(DefaultSkip, relPath)
+	for _, rule := range r.ignoreRules {
+		if rule.matches(relPath) {
+			skip = !rule.negate
+		}
+	}
+	if skip {
+		_, reinclude := splitNegations(r.Include)
+		skip = !matchAny(reinclude, relPath)
+	}
+	return skip
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// languageExtensions maps supported language names to their file extensions
+var languageExtensions = map[string][]string{
+	"c":          {".c", ".h"},
+	"cpp":        {".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx"},
+	"csharp":     {".cs"},
+	"go":         {".go"},
+	"java":       {".java"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs"},
+	"kotlin":     {".kt", ".kts"},
+	"php":        {".php"},
+	"python":     {".py", ".pyi"},
+	"ruby":       {".rb"},
+	"rust":       {".rs"},
+	"scala":      {".scala"},
+	"shell":      {".sh", ".bash", ".zsh"},
+	"swift":      {".swift"},
+	"typescript": {".ts", ".tsx"},
+}
+
+// docExtensions are treated as documentation and survive language filtering
+var docExtensions = map[string]bool{
+	".md":  true,
+	".mdx": true,
+	".rst": true,
+	".txt": true,
+}
+
+// SupportedLanguages returns the language names accepted by --languages
+func SupportedLanguages() []string {
+	names := make([]string, 0, len(languageExtensions))
+	for name := range languageExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateLanguages returns an error naming any unsupported language
+func ValidateLanguages(names []string) error {
+	for _, name := range names {
+		if _, ok := languageExtensions[strings.ToLower(name)]; !ok {
+			return fmt.Errorf("unknown language %q (supported: %s)", name, strings.Join(SupportedLanguages(), ", "))
+		}
+	}
+	return nil
+}
+
+// LanguageOf returns the language name for a path, or "" if unknown
+func LanguageOf(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for name, exts := range languageExtensions {
+		for _, e := range exts {
+			if e == ext {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// docGlobs are extra patterns for documentation files, from SetDocGlobs
+var docGlobs []string
+
+// SetDocGlobs adds patterns for files to treat as documentation, on top of
+// READMEs and docExtensions, for every later IsDocFile. Each is a glob as in
+// --include, or an extension such as .adoc. It's process-wide, like the
+// logger's level, since file classification has no other state.
+func SetDocGlobs(patterns []string) {
+	docGlobs = nil
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, "/*?") {
+			pattern = "*" + pattern
+		}
+		docGlobs = append(docGlobs, pattern)
+	}
+}
+
+// IsDocFile reports whether a path looks like project documentation
+func IsDocFile(path string) bool {
+	base := strings.ToUpper(filepath.Base(path))
+	if strings.HasPrefix(base, "README") {
+		return true
+	}
+	return docExtensions[strings.ToLower(filepath.Ext(path))] || MatchesDocGlobs(path)
+}
+
+// DocGlobs returns the patterns given to SetDocGlobs
+func DocGlobs() []string {
+	return docGlobs
+}
+
+// MatchesDocGlobs reports whether a path is documentation by the patterns
+// given to SetDocGlobs
+func MatchesDocGlobs(path string) bool {
+	return matchAny(docGlobs, path)
+}
+
+// matchesLanguages reports whether a path belongs to one of the languages
+func matchesLanguages(languages []string, path string) bool {
+	lang := LanguageOf(path)
+	for _, name := range languages {
+		if strings.ToLower(name) == lang {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// notebook is the part of a Jupyter notebook worth documenting: the cell
+// sources and the kernel language. Outputs and other metadata are ignored.
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string          `json:"cell_type"`
+		Source   json.RawMessage `json:"source"`
+	} `json:"cells"`
+}
+
+// IsNotebook reports whether path is a Jupyter notebook
+func IsNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// NotebookSource extracts the markdown and code cells of a notebook as
+// markdown, with code in fenced blocks. Outputs, which can be large and
+// base64-encoded, are dropped along with all metadata.
+func NotebookSource(data []byte) (string, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return "", fmt.Errorf("failed to parse notebook: %w", err)
+	}
+
+	lang := nb.Metadata.Kernelspec.Language
+	if lang == "" {
+		lang = nb.Metadata.LanguageInfo.Name
+	}
+
+	var sb strings.Builder
+	for _, cell := range nb.Cells {
+		source, err := cellSource(cell.Source)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse notebook: %w", err)
+		}
+		source = strings.TrimRight(source, "\n")
+		if strings.TrimSpace(source) == "" {
+			continue
+		}
+
+		switch cell.CellType {
+		case "markdown":
+			sb.WriteString(source + "\n\n")
+		case "code":
+			sb.WriteString("```" + lang + "\n" + source + "\n```\n\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+// cellSource decodes a cell's source, which nbformat allows as a single
+// string or a list of lines
+func cellSource(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return strings.Join(lines, ""), nil
+	}
+	var source string
+	if err := json.Unmarshal(raw, &source); err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// readNotebook lists a notebook by its extracted source, so its size and
+// line count reflect what reaches the prompt rather than the raw JSON
+func readNotebook(location, relPath string) (*RepoFile, error) {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	source, err := NotebookSource(data)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoFile{
+		Path:  relPath,
+		Size:  int64(len(source)),
+		Lines: strings.Count(source, "\n"),
+	}, nil
+}
@@ -0,0 +1,332 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// partialFilter asks the server to leave every blob out of a fetch; the
+// sparse checkout then fetches only the blobs under Subpath. go-git can't
+// fetch with a filter, so partial clones use the system git.
+const partialFilter = "blob:none"
+
+// partialClone clones a repository to document only Subpath with the system
+// git, downloading just the blobs under it: history and trees are fetched
+// without blobs, and the sparse checkout fetches the files it writes. It
+// reports false, leaving nothing behind, when git isn't installed or the
+// server doesn't support filters, so the caller can fall back to a go-git
+// clone; it does the same if the partial clone fails, since the go-git
+// path retries and reports missing or moved repositories.
+func (r *Repository) partialClone(ctx context.Context, srcPath, url string) (bool, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		logger.Verbosef("git not found, so the whole repository will be fetched: %v\n", err)
+		return false, nil
+	}
+
+	defaultBranch, filter, err := r.probeRemote(ctx, "", url)
+	switch {
+	case ctx.Err() != nil:
+		return true, ctx.Err()
+	case err != nil:
+		logger.Verbosef("Could not query %s for partial clone support: %v\n", url, err)
+		return false, nil
+	case !filter:
+		logger.Println("Server doesn't support partial clone, falling back to a shallow clone...")
+		return false, nil
+	}
+
+	logger.Printf("Cloning only %s (partial clone)...\n", r.Subpath)
+	err = r.initPartial(ctx, srcPath, url)
+	if err == nil {
+		err = r.fetchPartial(ctx, srcPath, defaultBranch)
+	}
+	switch {
+	case err == nil:
+		return true, nil
+	case ctx.Err() != nil:
+		// Marked incomplete, so the next run resumes it
+		return true, ctx.Err()
+	}
+	logger.Printf("Partial clone failed (%v), falling back to a shallow clone...\n", err)
+	if rmErr := os.RemoveAll(srcPath); rmErr != nil {
+		return true, fmt.Errorf("could not remove failed partial clone: %w", rmErr)
+	}
+	return false, nil
+}
+
+// initPartial creates an empty repository whose origin is a promisor
+// remote, so git fetches missing blobs from it when they're needed. It's
+// marked incomplete until fetchPartial succeeds.
+func (r *Repository) initPartial(ctx context.Context, srcPath, url string) error {
+	if _, err := r.runGit(ctx, "", "init", "-q", srcPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(markerPath(srcPath), nil, 0644); err != nil {
+		return fmt.Errorf("could not mark clone in progress: %w", err)
+	}
+	for _, args := range [][]string{
+		{"remote", "add", "origin", url},
+		{"config", "remote.origin.promisor", "true"},
+		{"config", "remote.origin.partialclonefilter", partialFilter},
+	} {
+		if _, err := r.runGit(ctx, srcPath, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchPartial fetches the commit to document without blobs and checks it
+// out, only Subpath when one is set. It completes new and interrupted
+// partial clones and updates existing ones alike. defaultBranch is used
+// when no branch, tag or commit was asked for.
+func (r *Repository) fetchPartial(ctx context.Context, srcPath, defaultBranch string) error {
+	if err := r.setSparsePaths(ctx, srcPath); err != nil {
+		return err
+	}
+
+	var refspec, target, branch string
+	switch {
+	case r.Commit != "":
+		refspec, target = r.Commit, r.Commit
+	case r.Tag != "":
+		refspec, target = fmt.Sprintf("+refs/tags/%[1]s:refs/tags/%[1]s", r.Tag), "refs/tags/"+r.Tag
+	default:
+		branch = r.Branch
+		if branch == "" {
+			branch = defaultBranch
+		}
+		refspec = fmt.Sprintf("+refs/heads/%[1]s:refs/remotes/origin/%[1]s", branch)
+		target = "refs/remotes/origin/" + branch
+	}
+
+	fetch := []string{"fetch", "-q", "--filter=" + partialFilter, "--depth=" + strconv.Itoa(r.depth()), "--no-tags", "origin", refspec}
+	if _, err := r.runGit(ctx, srcPath, fetch...); err != nil {
+		return fmt.Errorf("could not fetch repository: %w", err)
+	}
+	checkout := []string{"checkout", "-q", "-f", "--detach", target}
+	if branch != "" {
+		checkout = []string{"checkout", "-q", "-f", "-B", branch, target}
+	}
+	if _, err := r.runGit(ctx, srcPath, checkout...); err != nil {
+		return fmt.Errorf("could not check out %s: %w", target, err)
+	}
+
+	r.logPartialSavings(ctx, srcPath)
+	if err := os.Remove(markerPath(srcPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// setSparsePaths limits the worktree to Subpath, or restores all of it
+// when there's none. Files needed for the new set are fetched on demand.
+func (r *Repository) setSparsePaths(ctx context.Context, srcPath string) error {
+	args := []string{"sparse-checkout", "disable"}
+	if r.Subpath != "" {
+		args = []string{"sparse-checkout", "set", "--no-cone", sparsePattern(r.Subpath)}
+	}
+	if _, err := r.runGit(ctx, srcPath, args...); err != nil {
+		return fmt.Errorf("could not set sparse checkout: %w", err)
+	}
+	return nil
+}
+
+// sparsePattern is the sparse-checkout pattern matching only dir, with the
+// characters patterns treat specially escaped
+func sparsePattern(dir string) string {
+	var sb strings.Builder
+	sb.WriteString("/")
+	for _, c := range strings.Trim(filepath.ToSlash(dir), "/") {
+		if strings.ContainsRune(`\*?[!#`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteString("/")
+	return sb.String()
+}
+
+// updatePartial brings an existing partial clone up to date. A pinned
+// commit never changes, so it only has its sparse paths matched to Subpath.
+func (r *Repository) updatePartial(ctx context.Context, srcPath string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("%s is a partial clone, which needs git installed to update (delete it to clone again): %w", srcPath, err)
+	}
+	if r.Commit != "" && !cloneIncomplete(srcPath) {
+		return r.setSparsePaths(ctx, srcPath)
+	}
+
+	var defaultBranch string
+	if r.Commit == "" && r.Tag == "" && r.Branch == "" {
+		var err error
+		if defaultBranch, _, err = r.probeRemote(ctx, srcPath, "origin"); err != nil {
+			return fmt.Errorf("could not query origin: %w", err)
+		}
+	}
+	return r.fetchPartial(ctx, srcPath, defaultBranch)
+}
+
+// isPartial reports whether a clone was made by partialClone
+func isPartial(repo *git.Repository) bool {
+	cfg, err := repo.Config()
+	if err != nil {
+		return false
+	}
+	return cfg.Raw.Section("remote").Subsection("origin").Option("promisor") == "true"
+}
+
+// probeRemote asks remote, a URL or the name of a remote of the repository
+// in dir, for its default branch and whether it accepts filters, from the
+// capabilities in git's packet trace
+func (r *Repository) probeRemote(ctx context.Context, dir, remote string) (string, bool, error) {
+	var stdout, trace bytes.Buffer
+	cmd := r.gitCommand(ctx, dir, "ls-remote", "--symref", remote, "HEAD")
+	cmd.Env = append(cmd.Env, "GIT_TRACE_PACKET=1")
+	cmd.Stdout, cmd.Stderr = &stdout, &trace
+	if err := cmd.Run(); err != nil {
+		return "", false, commandError("ls-remote", err, trace.String())
+	}
+
+	var branch string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if target, ok := strings.CutPrefix(line, "ref: refs/heads/"); ok {
+			branch, _, _ = strings.Cut(target, "\t")
+		}
+	}
+	if branch == "" {
+		return "", false, errors.New("remote has no default branch")
+	}
+	return branch, advertisesFilter(trace.String()), nil
+}
+
+// advertisesFilter reports whether a packet trace shows the server
+// accepting filters: "fetch=... filter" in protocol v2, or a "filter"
+// capability after the first ref in v0
+func advertisesFilter(trace string) bool {
+	for _, line := range strings.Split(trace, "\n") {
+		_, packet, ok := strings.Cut(line, "< ")
+		if !ok {
+			continue
+		}
+		caps, ok := strings.CutPrefix(packet, "fetch=")
+		if !ok {
+			if _, caps, ok = strings.Cut(packet, `\0`); !ok {
+				_, caps, ok = strings.Cut(packet, "\x00")
+			}
+		}
+		if ok && containsField(caps, "filter") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// logPartialSavings reports the files under Subpath's siblings that were
+// never downloaded. Their sizes come from the GitHub API, since only the
+// trees naming them were fetched.
+func (r *Repository) logPartialSavings(ctx context.Context, srcPath string) {
+	if r.Subpath == "" {
+		return
+	}
+	repo, err := git.PlainOpen(srcPath)
+	if err != nil {
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return
+	}
+
+	dir := filepath.ToSlash(r.Subpath)
+	skipped := make(map[string]bool)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		if entry.Mode.IsFile() && !inDir(name, dir) {
+			skipped[name] = true
+		}
+	}
+
+	sizes, err := r.lookupTreeSizes(ctx, head.Hash().String())
+	if err != nil {
+		logger.Verbosef("Could not look up file sizes: %v\n", err)
+		logger.Printf("Partial clone skipped downloading %d files outside %s\n", len(skipped), dir)
+		return
+	}
+	var bytes int64
+	for name, size := range sizes {
+		if skipped[name] {
+			bytes += size
+		}
+	}
+	logger.Printf("Partial clone skipped downloading %d files (%d bytes) outside %s\n", len(skipped), bytes, dir)
+}
+
+// runGit runs the system git in dir, returning its output
+func (r *Repository) runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := r.gitCommand(ctx, dir, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", commandError(args[0], err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// gitCommand prepares a system git command that never prompts for
+// credentials and goes through Proxy if one is set
+func (r *Repository) gitCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	if r.Proxy != "" {
+		args = append([]string{"-c", "http.proxy=" + r.Proxy}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+// commandError describes a failed git command with the last line it printed
+func commandError(command string, err error, stderr string) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" && !strings.Contains(msg, "packet:") {
+		return fmt.Errorf("git %s: %w: %s", command, err, msg)
+	}
+	return fmt.Errorf("git %s: %w", command, err)
+}
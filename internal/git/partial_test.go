@@ -0,0 +1,140 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// apiTransport sends GitHub API requests on, and everything else to git
+type apiTransport struct {
+	api string
+	git http.RoundTripper
+}
+
+func (a *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.String(), a.api) {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return a.git.RoundTrip(req)
+}
+
+// useGitServer sends the system git's GitHub requests to server
+func useGitServer(t *testing.T, server string) {
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+server+"/.insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", "https://github.com/")
+}
+
+// missingObjects counts the objects reachable from HEAD that were never
+// downloaded
+func missingObjects(t *testing.T, srcPath string) int {
+	t.Helper()
+	out, err := exec.Command("git", "-C", srcPath, "rev-list", "--objects", "--missing=print", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("git rev-list: %v", err)
+	}
+	return strings.Count("\n"+string(out), "\n?")
+}
+
+func TestPartialClone(t *testing.T) {
+	files := map[string]string{
+		"docs/guide.md": "# Guide\n",
+		"big.bin":       strings.Repeat("x", 100<<10),
+		"main.go":       "package main\n",
+	}
+
+	tests := []struct {
+		name        string
+		allowFilter bool
+		wantPartial bool
+	}{
+		{"server allows filters", true, true},
+		{"server refuses filters", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := serveRepo(t, "user", "repo", files, tt.allowFilter)
+			useGitServer(t, server.String())
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				json.NewEncoder(w).Encode(map[string]any{"tree": []map[string]any{
+					{"path": "big.bin", "type": "blob", "size": 100 << 10},
+					{"path": "docs/guide.md", "type": "blob", "size": 8},
+					{"path": "main.go", "type": "blob", "size": 13},
+				}})
+			}))
+			t.Cleanup(api.Close)
+			defaultAPI := githubAPI
+			githubAPI = api.URL
+			t.Cleanup(func() { githubAPI = defaultAPI })
+			UseHTTPClient(&http.Client{Transport: &apiTransport{api: api.URL, git: &flakyTransport{server: server}}})
+
+			var log bytes.Buffer
+			logger.SetOutput(&log)
+			t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+
+			r := &Repository{User: "user", Repo: "repo", BaseDir: t.TempDir(), Subpath: "docs"}
+			// The second run updates the first run's clone
+			for run := 1; run <= 2; run++ {
+				srcPath, err := r.Clone(context.Background())
+				if err != nil {
+					t.Fatalf("run %d: Clone: %v", run, err)
+				}
+				if _, err := os.Stat(filepath.Join(srcPath, "docs", "guide.md")); err != nil {
+					t.Errorf("run %d: docs/guide.md not checked out: %v", run, err)
+				}
+				if _, err := os.Stat(filepath.Join(srcPath, "big.bin")); !os.IsNotExist(err) {
+					t.Errorf("run %d: big.bin outside the subpath is on disk", run)
+				}
+				if cloneIncomplete(srcPath) {
+					t.Errorf("run %d: clone still marked incomplete", run)
+				}
+
+				repo, err := git.PlainOpen(srcPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := isPartial(repo); got != tt.wantPartial {
+					t.Errorf("run %d: partial clone = %v, want %v", run, got, tt.wantPartial)
+				}
+				if missing := missingObjects(t, srcPath); (missing > 0) != tt.wantPartial {
+					t.Errorf("run %d: %d objects not downloaded", run, missing)
+				}
+				if tt.wantPartial && !strings.Contains(log.String(), "skipped downloading 2 files (102413 bytes)") {
+					t.Errorf("run %d: savings not logged:\n%s", run, log.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAdvertisesFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace string
+		want  bool
+	}{
+		{"v2 with filter", "packet:  git< version 2\npacket:  git< fetch=shallow wait-for-done filter\n", true},
+		{"v2 without filter", "packet:  git< version 2\npacket:  git< fetch=shallow wait-for-done\n", false},
+		{"v0 with filter", `packet:  git< 0123abcd HEAD\0multi_ack thin-pack filter agent=git/2.39` + "\n", true},
+		{"v0 without filter", `packet:  git< 0123abcd HEAD\0multi_ack thin-pack agent=git/2.39` + "\n", false},
+		{"filter in a ref name", "packet:  git< 0123abcd refs/heads/filter\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := advertisesFilter(tt.trace); got != tt.want {
+				t.Errorf("advertisesFilter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
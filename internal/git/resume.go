@@ -0,0 +1,262 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// incompleteMarker is created in .git when a clone starts and removed once
+// the checkout finishes, so an interrupted clone can be told apart from a
+// complete one and resumed instead of starting over.
+const incompleteMarker = "repocontext-incomplete"
+
+func markerPath(srcPath string) string {
+	return filepath.Join(srcPath, ".git", incompleteMarker)
+}
+
+func cloneIncomplete(srcPath string) bool {
+	_, err := os.Stat(markerPath(srcPath))
+	return err == nil
+}
+
+// initClone creates an empty repository with an origin remote, leaving it
+// marked incomplete until completeClone succeeds. With a branch set, the
+// remote only tracks that branch.
+func (r *Repository) initClone(srcPath, url string) (*git.Repository, error) {
+	repo, err := git.PlainInit(srcPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize repository: %w", err)
+	}
+	if err := os.WriteFile(markerPath(srcPath), nil, 0644); err != nil {
+		return nil, fmt.Errorf("could not mark clone in progress: %w", err)
+	}
+	remote := &config.RemoteConfig{Name: "origin", URLs: []string{url}}
+	if r.Branch != "" {
+		remote.Fetch = []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/%[1]s:refs/remotes/origin/%[1]s", r.Branch))}
+	}
+	if _, err := repo.CreateRemote(remote); err != nil {
+		return nil, fmt.Errorf("could not add origin remote: %w", err)
+	}
+	return repo, nil
+}
+
+// completeClone fetches the default branch and checks it out. Objects that
+// were already fetched by an interrupted attempt aren't downloaded again.
+func (r *Repository) completeClone(ctx context.Context, repo *git.Repository, srcPath string) error {
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return fmt.Errorf("failed to get origin remote: %w", err)
+	}
+
+	switch {
+	case r.Commit != "":
+		if err := r.fetchCommit(ctx, repo, remote); err != nil {
+			return err
+		}
+		if err := r.checkoutDetached(repo, plumbing.NewHash(r.Commit), "commit "+r.Commit); err != nil {
+			return err
+		}
+		return os.Remove(markerPath(srcPath))
+	case r.Tag != "":
+		hash, err := r.fetchTag(ctx, repo, remote)
+		if err != nil {
+			return err
+		}
+		if err := r.checkoutDetached(repo, hash, "tag "+r.Tag); err != nil {
+			return err
+		}
+		return os.Remove(markerPath(srcPath))
+	}
+
+	branch := r.Branch
+	if branch == "" {
+		refs, err := remote.ListContext(ctx, &git.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("could not list remote branches: %w", err)
+		}
+		if branch, err = defaultBranch(refs); err != nil {
+			return err
+		}
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		Depth:    r.depth(),
+		Progress: logger.ProgressWriter(),
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("could not fetch repository: %w", err)
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return fmt.Errorf("branch %q not found on origin: %w", branch, err)
+	}
+
+	localRef := plumbing.NewBranchReferenceName(branch)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(localRef, remoteRef.Hash())); err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, localRef)); err != nil {
+		return fmt.Errorf("failed to set HEAD: %w", err)
+	}
+	err = repo.CreateBranch(&config.Branch{Name: branch, Remote: "origin", Merge: localRef})
+	if err != nil && err != git.ErrBranchExists {
+		return fmt.Errorf("failed to configure branch %s: %w", branch, err)
+	}
+
+	if r.Subpath != "" {
+		if err := r.checkoutSparse(repo); err != nil {
+			return err
+		}
+	} else {
+		w, err := repo.Worktree()
+		if err != nil {
+			return fmt.Errorf("failed to get worktree: %w", err)
+		}
+		if err := w.Reset(&git.ResetOptions{Commit: remoteRef.Hash(), Mode: git.HardReset}); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", branch, err)
+		}
+	}
+
+	return os.Remove(markerPath(srcPath))
+}
+
+// depth is how many commits of history a fetch asks for
+func (r *Repository) depth() int {
+	if r.History > 1 {
+		return r.History
+	}
+	return 1
+}
+
+// pinnedRef records a commit fetched by SHA, which has no branch of its own
+const pinnedRef = "refs/remotes/origin/pinned"
+
+// fetchCommit fetches just the pinned commit where the server allows asking
+// for a SHA directly, as GitHub does. Otherwise it fetches full history so
+// the commit can be reached from a branch.
+func (r *Repository) fetchCommit(ctx context.Context, repo *git.Repository, remote *git.Remote) error {
+	err := remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(r.Commit + ":" + pinnedRef)},
+		Depth:    r.depth(),
+		Progress: logger.ProgressWriter(),
+	})
+	switch {
+	case err == nil, err == git.NoErrAlreadyUpToDate:
+		return nil
+	case err != git.ErrExactSHA1NotSupported:
+		return fmt.Errorf("could not fetch commit %s: %w", r.Commit, err)
+	}
+
+	logger.Printf("Server can't fetch a single commit; fetching full history to reach %s...\n", r.Commit[:12])
+	err = remote.FetchContext(ctx, &git.FetchOptions{Progress: logger.ProgressWriter()})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("could not fetch repository: %w", err)
+	}
+	return nil
+}
+
+// fetchTag fetches the tag to document and returns the commit it points
+// at, peeling an annotated tag
+func (r *Repository) fetchTag(ctx context.Context, repo *git.Repository, remote *git.Remote) (plumbing.Hash, error) {
+	name := plumbing.NewTagReferenceName(r.Tag)
+	err := remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%[1]s:%[1]s", name))},
+		Depth:    r.depth(),
+		Tags:     git.NoTags,
+		Progress: logger.ProgressWriter(),
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, fmt.Errorf("could not fetch tag %s: %w", r.Tag, err)
+	}
+
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("tag %q not found on origin: %w", r.Tag, err)
+	}
+	tag, err := repo.TagObject(ref.Hash())
+	switch {
+	case err == plumbing.ErrObjectNotFound:
+		// A lightweight tag names the commit itself
+		return ref.Hash(), nil
+	case err != nil:
+		return plumbing.ZeroHash, fmt.Errorf("failed to read tag %s: %w", r.Tag, err)
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("tag %s does not point at a commit: %w", r.Tag, err)
+	}
+	return commit.Hash, nil
+}
+
+// checkoutDetached detaches HEAD at hash, a pinned commit or a tag's
+// commit described by name, and checks it out
+func (r *Repository) checkoutDetached(repo *git.Repository, hash plumbing.Hash, name string) error {
+	if _, err := repo.CommitObject(hash); err != nil {
+		return fmt.Errorf("%s not found on origin: %w", name, err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash)); err != nil {
+		return fmt.Errorf("failed to set HEAD: %w", err)
+	}
+
+	if r.Subpath != "" {
+		return r.checkoutSparse(repo)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", name, err)
+	}
+	return nil
+}
+
+// defaultBranch picks the branch the remote's HEAD points at
+func defaultBranch(refs []*plumbing.Reference) (string, error) {
+	var head *plumbing.Reference
+	branches := make(map[string]plumbing.Hash)
+	for _, ref := range refs {
+		switch {
+		case ref.Name() == plumbing.HEAD:
+			head = ref
+		case ref.Name().IsBranch():
+			branches[ref.Name().Short()] = ref.Hash()
+		}
+	}
+
+	if head != nil && head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+
+	// Without a symref, match HEAD's hash, preferring the usual names
+	for _, name := range []string{"main", "master"} {
+		if hash, ok := branches[name]; ok && (head == nil || hash == head.Hash()) {
+			return name, nil
+		}
+	}
+	if head != nil {
+		for name, hash := range branches {
+			if hash == head.Hash() {
+				return name, nil
+			}
+		}
+	}
+	if len(branches) == 0 {
+		return "", fmt.Errorf("remote has no branches")
+	}
+
+	names := make([]string, 0, len(branches))
+	for name := range branches {
+		names = append(names, name)
+	}
+	return "", fmt.Errorf("could not determine the default branch (remote has %s)", strings.Join(names, ", "))
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runTestGit runs the system git in dir, failing the test on an error
+func runTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func TestCloneTag(t *testing.T) {
+	server, bare := serveRepo(t, "user", "repo", map[string]string{"main.go": "v1\n"}, false)
+	UseHTTPClient(&http.Client{Transport: &flakyTransport{server: server}})
+
+	// The default branch moves on past the tagged commit
+	work := t.TempDir()
+	runTestGit(t, work, "clone", "-q", bare, ".")
+	if err := os.WriteFile(filepath.Join(work, "main.go"), []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, work, "commit", "-q", "-am", "second")
+	runTestGit(t, work, "tag", "-a", "-m", "annotated", "annotated", "HEAD~1")
+	runTestGit(t, work, "tag", "lightweight", "HEAD~1")
+	runTestGit(t, work, "push", "-q", "origin", "HEAD", "--tags")
+
+	checkedOut := func(t *testing.T, r *Repository) string {
+		t.Helper()
+		srcPath, err := r.Clone(context.Background())
+		if err != nil {
+			t.Fatalf("Clone: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(srcPath, "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	baseDir := t.TempDir()
+	for _, tag := range []string{"annotated", "lightweight"} {
+		t.Run(tag, func(t *testing.T) {
+			if got := checkedOut(t, &Repository{User: "user", Repo: "repo", Tag: tag, BaseDir: baseDir}); got != "v1\n" {
+				t.Errorf("main.go = %q, want the tagged v1", got)
+			}
+		})
+	}
+	t.Run("default branch", func(t *testing.T) {
+		if got := checkedOut(t, &Repository{User: "user", Repo: "repo", BaseDir: baseDir}); got != "v2\n" {
+			t.Errorf("main.go = %q, want v2", got)
+		}
+	})
+
+	// Updating an existing clone follows a moved tag
+	t.Run("moved tag", func(t *testing.T) {
+		runTestGit(t, work, "tag", "-f", "-a", "-m", "moved", "annotated", "HEAD")
+		runTestGit(t, work, "push", "-q", "-f", "origin", "annotated")
+		if got := checkedOut(t, &Repository{User: "user", Repo: "repo", Tag: "annotated", BaseDir: baseDir}); got != "v2\n" {
+			t.Errorf("main.go = %q, want v2 after the tag moved", got)
+		}
+	})
+}
+
+func TestVersionIdentifierDistinct(t *testing.T) {
+	repos := []*Repository{
+		{},
+		{Tag: "v1.0"},
+		{Tag: "release/1.0"},
+		{Tag: "release_1.0"},
+		{Branch: "feature/x"},
+		{Branch: "feature_x"},
+		{Branch: "feature%2Fx"},
+		{Commit: "0123456789abcdef0123456789abcdef01234567"},
+	}
+	seen := make(map[string]*Repository)
+	for _, r := range repos {
+		id := r.versionIdentifier()
+		if other, ok := seen[id]; ok {
+			t.Errorf("%+v and %+v share the directory %q", *r, *other, id)
+		}
+		if filepath.Base(id) != id {
+			t.Errorf("%+v has the nested directory %q", *r, id)
+		}
+		seen[id] = r
+	}
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// cloneAttempts bounds how often a clone is tried when the network fails
+// transiently, and cloneRetryDelay is the wait before the first retry,
+// doubling after each
+const cloneAttempts = 3
+
+var cloneRetryDelay = 2 * time.Second
+
+// transientMessages identify network failures in errors that go-git reports
+// as text rather than wrapping the underlying error
+var transientMessages = []string{
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporary failure in name resolution",
+	"server misbehaving",
+	"unexpected eof",
+}
+
+// completeCloneWithRetry runs completeClone, retrying with backoff while it
+// fails with a transient network error. Objects fetched by a failed attempt
+// are kept, so a retry only downloads the rest. Other errors, such as a
+// missing repository or failed authentication, are returned at once, and
+// cancelling ctx stops the wait between attempts.
+func (r *Repository) completeCloneWithRetry(ctx context.Context, repo *git.Repository, srcPath string) error {
+	delay := cloneRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := r.completeClone(ctx, repo, srcPath)
+		if err == nil || attempt == cloneAttempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		logger.Printf("Clone failed (%v), retrying in %s (attempt %d of %d)...\n", err, delay, attempt+1, cloneAttempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is a network failure worth retrying: a
+// reset connection, a timeout or a temporary DNS failure
+func isTransient(err error) bool {
+	if err == nil || isNotFound(err) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
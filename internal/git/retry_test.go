@@ -0,0 +1,171 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// flakyTransport fails its first failures requests with a reset connection,
+// then sends the rest to server
+type flakyTransport struct {
+	failures int32
+	calls    atomic.Int32
+	server   *url.URL
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, errors.New("read tcp: connection reset by peer")
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = f.server.Scheme, f.server.Host
+	req.Host = f.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// serveBareRepo serves a bare repository with one commit over smart HTTP at
+// /user/repo.git, using git http-backend
+func serveBareRepo(t *testing.T, user, repo string) *url.URL {
+	t.Helper()
+	server, _ := serveRepo(t, user, repo, map[string]string{"main.go": "package main\n"}, false)
+	return server
+}
+
+// serveRepo serves a bare repository with one commit of files over smart
+// HTTP at /user/repo.git, accepting partial clone filters if allowFilter. It
+// returns the server's URL and the bare repository's path.
+func serveRepo(t *testing.T, user, repo string, files map[string]string, allowFilter bool) (*url.URL, string) {
+	t.Helper()
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not installed")
+	}
+	out, err := exec.Command(gitPath, "--exec-path").Output()
+	if err != nil {
+		t.Skipf("git --exec-path: %v", err)
+	}
+	backend := filepath.Join(strings.TrimSpace(string(out)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend not installed")
+	}
+
+	work := t.TempDir()
+	r, err := git.PlainInit(work, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(work, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := w.Commit("initial", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, user, repo+".git")
+	if _, err := git.PlainClone(bare, true, &git.CloneOptions{URL: work}); err != nil {
+		t.Fatal(err)
+	}
+	if allowFilter {
+		if out, err := exec.Command(gitPath, "-C", bare, "config", "uploadpack.allowFilter", "true").CombinedOutput(); err != nil {
+			t.Fatalf("git config: %v: %s", err, out)
+		}
+	}
+	server := httptest.NewServer(&cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+	return serverURL, bare
+}
+
+func TestCloneRetriesTransientFailures(t *testing.T) {
+	server := serveBareRepo(t, "user", "repo")
+	delay := cloneRetryDelay
+	cloneRetryDelay = time.Millisecond
+	t.Cleanup(func() { cloneRetryDelay = delay })
+
+	tests := []struct {
+		name     string
+		failures int32
+		wantErr  bool
+	}{
+		{"no failures", 0, false},
+		{"recovers", cloneAttempts - 1, false},
+		{"gives up", cloneAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &flakyTransport{failures: tt.failures, server: server}
+			UseHTTPClient(&http.Client{Transport: transport})
+
+			r := &Repository{User: "user", Repo: "repo", BaseDir: t.TempDir()}
+			srcPath, err := r.Clone(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Clone succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Clone: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(srcPath, "main.go")); err != nil {
+				t.Errorf("main.go not checked out: %v", err)
+			}
+			if cloneIncomplete(srcPath) {
+				t.Error("clone still marked incomplete")
+			}
+		})
+	}
+}
+
+func TestCloneRetryCancelled(t *testing.T) {
+	server := serveBareRepo(t, "user", "repo")
+	delay := cloneRetryDelay
+	cloneRetryDelay = time.Hour
+	t.Cleanup(func() { cloneRetryDelay = delay })
+
+	UseHTTPClient(&http.Client{Transport: &flakyTransport{failures: 1, server: server}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := &Repository{User: "user", Repo: "repo", BaseDir: t.TempDir()}
+	start := time.Now()
+	_, err := r.Clone(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Clone error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Clone took %s after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// errSizeLimit stops walking a checkout once it is known to be too large
+var errSizeLimit = errors.New("size limit exceeded")
+
+// tooLarge explains a refused repository and how to document it anyway
+func (r *Repository) tooLarge(size int64) error {
+	return fmt.Errorf("%s/%s is at least %d MB, over the %d MB repository size limit; document a subdirectory with --path, or raise --max-repo-size (0 disables the limit)",
+		r.User, r.Repo, size>>20, r.MaxRepoSize>>20)
+}
+
+// checkRemoteSize asks the GitHub API how big the repository is before
+// cloning. The lookup is best effort: if it fails, the checkout is measured
+// after cloning instead.
+func (r *Repository) checkRemoteSize() error {
+	info, err := r.lookupRepo()
+	if err != nil {
+		logger.Verbosef("Could not look up repository size: %v\n", err)
+		return nil
+	}
+	if size := info.Size << 10; size > r.MaxRepoSize {
+		return r.tooLarge(size)
+	}
+	return nil
+}
+
+// checkCheckoutSize measures the files under RootPath, excluding .git, and
+// fails once they exceed MaxRepoSize.
+func (r *Repository) checkCheckoutSize() error {
+	var total int64
+	err := filepath.WalkDir(r.RootPath(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		if total > r.MaxRepoSize {
+			return errSizeLimit
+		}
+		return nil
+	})
+	if errors.Is(err, errSizeLimit) {
+		return r.tooLarge(total)
+	}
+	return err
+}
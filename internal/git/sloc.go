@@ -0,0 +1,78 @@
+package git
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// lineCommentPrefixes lists the single-line comment markers per language
+var lineCommentPrefixes = map[string][]string{
+	"c":          {"//", "/*", "*"},
+	"cpp":        {"//", "/*", "*"},
+	"csharp":     {"//", "/*", "*"},
+	"go":         {"//", "/*", "*"},
+	"java":       {"//", "/*", "*"},
+	"javascript": {"//", "/*", "*"},
+	"kotlin":     {"//", "/*", "*"},
+	"php":        {"//", "#", "/*", "*"},
+	"python":     {"#"},
+	"ruby":       {"#"},
+	"rust":       {"//", "/*", "*"},
+	"scala":      {"//", "/*", "*"},
+	"shell":      {"#"},
+	"swift":      {"//", "/*", "*"},
+	"typescript": {"//", "/*", "*"},
+}
+
+// countLines counts the lines in a file. In strict mode blank lines and
+// lines that are only a comment are skipped.
+func countLines(path string, strict bool) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	prefixes := lineCommentPrefixes[LanguageOf(path)]
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lines := 0
+	for scanner.Scan() {
+		if strict && isBlankOrComment(scanner.Text(), prefixes) {
+			continue
+		}
+		lines++
+	}
+	return lines, scanner.Err()
+}
+
+func isBlankOrComment(line string, prefixes []string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LineCounts totals the line counts of files, overall and per language.
+// Files in no known language are counted under "other".
+func LineCounts(files map[string]*RepoFile) (int, map[string]int) {
+	total := 0
+	byLanguage := make(map[string]int)
+	for path, file := range files {
+		lang := LanguageOf(path)
+		if lang == "" {
+			lang = "other"
+		}
+		byLanguage[lang] += file.Lines
+		total += file.Lines
+	}
+	return total, byLanguage
+}
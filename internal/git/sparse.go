@@ -0,0 +1,169 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// checkoutSparse makes the worktree contain only the configured subpath of
+// a go-git clone, used when partialClone can't be. go-git doesn't support
+// partial clone filters, so all blobs in the shallow pack are still fetched;
+// the saving is in what gets written to disk and later scanned. go-git's own sparse checkout only works on an already
+// populated index, so files are written from HEAD's tree directly and the
+// remaining index entries are marked skip-worktree.
+func (r *Repository) checkoutSparse(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	// Point the index at HEAD without touching the worktree
+	if err := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset}); err != nil {
+		return fmt.Errorf("failed to populate index: %w", err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD tree: %w", err)
+	}
+
+	dir := filepath.ToSlash(r.Subpath)
+	root := w.Filesystem.Root()
+	var skipped int64
+	err = tree.Files().ForEach(func(f *object.File) error {
+		target := filepath.Join(root, filepath.FromSlash(f.Name))
+		if !inDir(f.Name, dir) {
+			skipped += f.Size
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		return writeTreeFile(f, target)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check out %s: %w", dir, err)
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		e.SkipWorktree = !inDir(e.Name, dir)
+	}
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	logger.Printf("Checked out only %s; %d bytes outside it were fetched but not written to disk\n", dir, skipped)
+	return nil
+}
+
+func inDir(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// writeTreeFile writes a file from the git tree to disk
+func writeTreeFile(f *object.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if f.Mode == filemode.Symlink {
+		link, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		os.Remove(target)
+		return os.Symlink(string(link), target)
+	}
+
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// isSparse reports whether a previous run left the checkout sparse
+func isSparse(repo *git.Repository) bool {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return false
+	}
+	for _, e := range idx.Entries {
+		if e.SkipWorktree {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCheckout makes an existing clone's worktree match Subpath, whatever
+// an earlier run left: the whole tree without one, or just the subpath
+func (r *Repository) matchCheckout(repo *git.Repository) error {
+	if isSparse(repo) {
+		w, err := repo.Worktree()
+		if err != nil {
+			return fmt.Errorf("failed to get worktree: %w", err)
+		}
+		if err := restoreFullCheckout(repo, w); err != nil {
+			return err
+		}
+	}
+	if r.Subpath != "" {
+		return r.checkoutSparse(repo)
+	}
+	return nil
+}
+
+// restoreFullCheckout undoes a sparse checkout so every file is on disk again
+func restoreFullCheckout(repo *git.Repository, w *git.Worktree) error {
+	logger.Println("Restoring full checkout of previously sparse clone...")
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		e.SkipWorktree = false
+	}
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	if err := w.Reset(&git.ResetOptions{Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to restore full checkout: %w", err)
+	}
+	return nil
+}
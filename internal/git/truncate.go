@@ -0,0 +1,45 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// truncateHeadShare is how much of a truncated file's budget goes to its
+// start, which usually holds the declarations; the rest goes to its end
+const truncateHeadShare = 0.7
+
+// TruncateContent shortens content longer than limit bytes to its first and
+// last whole lines, joined by a marker saying how much was cut, so a large
+// file still contributes a representative portion to the prompt. It reports
+// whether content was truncated. The result stays within limit bytes unless
+// no whole line fits, when the marker alone is returned.
+func TruncateContent(content string, limit int) (string, bool) {
+	if limit <= 0 || len(content) <= limit {
+		return content, false
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	marker := func(cut int) string {
+		return fmt.Sprintf("... [truncated %d of %d lines] ...\n", cut, len(lines))
+	}
+	budget := limit - len(marker(len(lines)))
+
+	// Whole lines from the start, then from the end with what's left
+	headBudget := int(float64(budget) * truncateHeadShare)
+	head, used := 0, 0
+	for head < len(lines) && used+len(lines[head]) <= headBudget {
+		used += len(lines[head])
+		head++
+	}
+	tail := len(lines)
+	for tail > head && used+len(lines[tail-1]) <= budget {
+		used += len(lines[tail-1])
+		tail--
+	}
+
+	return strings.Join(lines[:head], "") + marker(tail-head) + strings.Join(lines[tail:], ""), true
+}
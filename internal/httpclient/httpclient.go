@@ -0,0 +1,28 @@
+// Package httpclient builds the HTTP client shared by git clones and LLM
+// API calls, so both honor the same proxy settings.
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// New returns an HTTP client that sends requests through proxyURL when set
+// (http://, https:// and socks5:// are supported), and otherwise falls back
+// to the standard HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables.
+func New(proxyURL string) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxyURL)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/bedrock"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// Supported providers
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderAzure     = "azure"
+	ProviderBedrock   = "bedrock"
+)
+
+// Providers lists the supported providers, the default first
+var Providers = []string{ProviderAnthropic, ProviderAzure, ProviderBedrock}
+
+// Backend is the API endpoint requests are sent to and the credentials it
+// takes
+type Backend struct {
+	Provider   string // one of Providers
+	APIKey     string
+	BaseURL    string // endpoint; required for azure, optional for anthropic (e.g. a gateway)
+	APIVersion string // azure API version (default openai.DefaultAPIVersion)
+	Region     string // bedrock AWS region
+}
+
+// Validate reports an unknown provider or missing credentials before any
+// request is made
+func (b Backend) Validate() error {
+	switch b.Provider {
+	case ProviderAnthropic:
+		if b.APIKey == "" {
+			return errors.New("ANTHROPIC_API_KEY or ANTHROPIC_API_KEY_FILE environment variable must be set")
+		}
+	case ProviderAzure:
+		if b.APIKey == "" {
+			return errors.New("AZURE_OPENAI_API_KEY environment variable must be set for the azure provider")
+		}
+		if b.BaseURL == "" {
+			return errors.New("the azure provider needs the resource endpoint: set --base-url or AZURE_OPENAI_ENDPOINT")
+		}
+	case ProviderBedrock:
+		if b.Region == "" {
+			return errors.New("the bedrock provider needs an AWS region: set AWS_REGION or AWS_DEFAULT_REGION")
+		}
+		if !hasAWSCredentials() {
+			return errors.New("the bedrock provider needs AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or AWS_PROFILE, or configure ~/.aws/credentials")
+		}
+	default:
+		return fmt.Errorf("unsupported provider %q (supported: %s)", b.Provider, strings.Join(Providers, ", "))
+	}
+	return nil
+}
+
+// hasAWSCredentials reports whether the AWS SDK's default chain has
+// credentials to find without asking the network: keys, a profile, a web
+// identity or container role, or a shared credentials or config file
+func hasAWSCredentials() bool {
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
+		return true
+	}
+	for _, name := range []string{"AWS_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	for _, path := range []string{os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), os.Getenv("AWS_CONFIG_FILE"), config.DefaultSharedCredentialsFilename(), config.DefaultSharedConfigFilename()} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newModel creates the langchaingo model for one model name. For azure the
+// name is the deployment name, and for bedrock the model ID (e.g.
+// anthropic.claude-3-5-sonnet-20240620-v1:0).
+func (b Backend) newModel(model string, httpClient *http.Client) (llms.Model, error) {
+	switch b.Provider {
+	case ProviderAzure:
+		version := b.APIVersion
+		if version == "" {
+			version = openai.DefaultAPIVersion
+		}
+		llm, err := openai.New(
+			openai.WithAPIType(openai.APITypeAzure),
+			openai.WithToken(b.APIKey),
+			openai.WithBaseURL(b.BaseURL),
+			openai.WithAPIVersion(version),
+			openai.WithModel(model),
+			openai.WithHTTPClient(httpClient),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure OpenAI client: %w", err)
+		}
+		return llm, nil
+	case ProviderBedrock:
+		cfg, err := config.LoadDefaultConfig(context.Background(),
+			config.WithRegion(b.Region),
+			config.WithHTTPClient(httpClient),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+		llm, err := bedrock.New(
+			bedrock.WithModel(model),
+			bedrock.WithClient(bedrockruntime.NewFromConfig(cfg)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Bedrock client: %w", err)
+		}
+		return llm, nil
+	default:
+		options := []anthropic.Option{
+			anthropic.WithToken(b.APIKey),
+			anthropic.WithModel(model),
+			anthropic.WithHTTPClient(httpClient),
+		}
+		if b.BaseURL != "" {
+			options = append(options, anthropic.WithBaseURL(b.BaseURL))
+		}
+		llm, err := anthropic.New(options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Anthropic client: %w", err)
+		}
+		return llm, nil
+	}
+}
@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const (
+	modelsURL        = "https://api.anthropic.com/v1/models"
+	anthropicVersion = "2023-06-01"
+)
+
+// CheckAPIKey verifies the key with a models-list request, which costs no
+// tokens. Failures are classified like those of generation calls.
+func CheckAPIKey(ctx context.Context, httpClient *http.Client, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, modelsURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach the Anthropic API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return classifyError(fmt.Errorf("API returned unexpected status code: %d", resp.StatusCode))
+	}
+	return nil
+}
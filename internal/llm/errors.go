@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrorKind classifies API failures that users can act on
+type ErrorKind int
+
+const (
+	ErrorUnknown ErrorKind = iota
+	ErrorInvalidKey
+	ErrorQuotaExceeded
+	ErrorRateLimited
+	ErrorModelNotFound
+	ErrorOverloaded
+)
+
+// APIError wraps a failed API call with its classification
+type APIError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Hint returns an actionable explanation of the failure
+func (e *APIError) Hint() string {
+	switch e.Kind {
+	case ErrorInvalidKey:
+		return "The API key was rejected. Check that ANTHROPIC_API_KEY (or the file named by ANTHROPIC_API_KEY_FILE) holds a valid, active key."
+	case ErrorQuotaExceeded:
+		return "Your account is out of credit or over its usage quota. Check billing in the Anthropic console."
+	case ErrorRateLimited:
+		return "The API is rate limiting requests. Wait a minute and try again, or reduce --max-size."
+	case ErrorModelNotFound:
+		return "The requested model was not found. Check the model name (--model or REPOCONTEXT_MODEL)."
+	case ErrorOverloaded:
+		return "The API is temporarily overloaded. Try again shortly."
+	default:
+		return "The API request failed."
+	}
+}
+
+// classifyError wraps known API failures in an *APIError, leaving other
+// errors unchanged.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	kind := ErrorUnknown
+	switch {
+	case strings.Contains(msg, "status code: 401"), strings.Contains(msg, "invalid x-api-key"),
+		strings.Contains(msg, "authentication_error"):
+		kind = ErrorInvalidKey
+	case strings.Contains(msg, "credit balance"), strings.Contains(msg, "quota"), strings.Contains(msg, "billing"):
+		kind = ErrorQuotaExceeded
+	case strings.Contains(msg, "status code: 429"), strings.Contains(msg, "rate limit"):
+		kind = ErrorRateLimited
+	case strings.Contains(msg, "status code: 404"), strings.Contains(msg, "not_found_error"):
+		kind = ErrorModelNotFound
+	case strings.Contains(msg, "status code: 529"), strings.Contains(msg, "overloaded"):
+		kind = ErrorOverloaded
+	default:
+		return err
+	}
+
+	return &APIError{Kind: kind, Err: err}
+}
+
+// isUnavailable reports whether err means the model couldn't serve the
+// request at all, so another model may succeed. Content problems and
+// account-wide failures like a bad key don't qualify.
+func isUnavailable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind == ErrorOverloaded || apiErr.Kind == ErrorModelNotFound
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, code := range []string{"status code: 500", "status code: 502", "status code: 503"} {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
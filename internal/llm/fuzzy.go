@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+)
+
+// maxPathTypos is the largest edit distance at which a path the model named
+// is taken as a typo of a real one
+const maxPathTypos = 2
+
+// correctPath maps a path the model named but that doesn't exist onto the
+// real file it most likely meant: a case-insensitive match, the only path
+// ending in it (a dropped leading directory), or the only path within
+// maxPathTypos edits. It returns false when there's no single obvious match.
+func correctPath(path string, files map[string]*git.RepoFile) (string, bool) {
+	slashed := filepath.ToSlash(path)
+	var folded, suffixed, typos []string
+	best := maxPathTypos + 1
+	for candidate := range files {
+		slashedCandidate := filepath.ToSlash(candidate)
+		if strings.EqualFold(slashedCandidate, slashed) {
+			folded = append(folded, candidate)
+		}
+		if strings.HasSuffix(slashedCandidate, "/"+slashed) {
+			suffixed = append(suffixed, candidate)
+		}
+
+		// Only paths of similar length can be within a few edits
+		if abs(len(slashedCandidate)-len(slashed)) > maxPathTypos {
+			continue
+		}
+		switch d := editDistance(slashedCandidate, slashed); {
+		case d < best:
+			best, typos = d, []string{candidate}
+		case d == best:
+			typos = append(typos, candidate)
+		}
+	}
+
+	for _, matches := range [][]string{folded, suffixed, typos} {
+		if len(matches) == 1 {
+			return matches[0], true
+		}
+		if len(matches) > 1 {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+package llm
+
+import "context"
+
+// DefaultMaxConcurrency bounds in-flight API requests unless overridden
+const DefaultMaxConcurrency = 2
+
+// limiter is shared by every Client in the process, so sections generated
+// in parallel stay under one limit
+var limiter = make(chan struct{}, DefaultMaxConcurrency)
+
+// SetMaxConcurrency sets how many API requests may be in flight at once.
+// Call it once, before any client is used.
+func SetMaxConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	limiter = make(chan struct{}, n)
+}
+
+// acquire waits for a free request slot; the returned func releases it. The
+// slot is released to the channel it was taken from, even if the limit has
+// since been replaced.
+func acquire(ctx context.Context) (func(), error) {
+	ch := limiter
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
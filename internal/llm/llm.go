@@ -3,52 +3,222 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/internal/selector"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/anthropic"
 )
 
+// DefaultMaxTokens caps the length of each completion
+const DefaultMaxTokens = 4096
+
+// ErrTokenCap is returned for a streamed completion cancelled at the hard
+// token cap
+var ErrTokenCap = errors.New("completion exceeded the hard token cap")
+
+// bytesPerToken is the rough conversion used to estimate prompt sizes
+const bytesPerToken = 4
+
+// minRemainingCandidates is how many unselected files must remain before an
+// under-filled selection is worth warning about.
+const minRemainingCandidates = 10
+
 type Client struct {
-	llm *anthropic.LLM
+	llms     []llms.Model // one per model, in fallback order
+	models   []string
+	recorder *recorder
+	replay   *replayer
+
+	SelectionFloor float64 // fraction of the budget below which a selection counts as thin
+	TopUp          bool    // fill a thin selection with heuristically ranked files
+	ContextWindow  int     // model context limit in tokens; larger selection prompts aren't sent (0 = unchecked)
+
+	// Limits on streamed completions, in estimated tokens (0 = off)
+	SoftTokenCap int // warn once a completion passes this
+	HardTokenCap int // cancel a completion that passes this
+
+	missing []string // paths the last selection named that don't exist
+}
+
+var _ selector.FileSelector = (*Client)(nil)
+
+// GenerateWithStream sends the system message, if any, and the user prompt
+// to the model and returns the full completion, of up to DefaultMaxTokens.
+// When stream is non-nil, chunks are also written to it as they arrive.
+func (c *Client) GenerateWithStream(ctx context.Context, system, prompt string, stream io.Writer) (string, error) {
+	completion, _, err := c.GenerateWithModel(ctx, system, prompt, 0, stream)
+	return completion, err
 }
 
-// internal/llm/llm.go
-// internal/llm/llm.go
-func (c *Client) GenerateWithStream(ctx context.Context, prompt string) (string, error) {
-	fmt.Println("Generating response...")
+// GenerateWithModel is GenerateWithStream with a completion limit of
+// maxTokens (0 = DefaultMaxTokens) that also reports which model in the
+// fallback chain produced the completion.
+func (c *Client) GenerateWithModel(ctx context.Context, system, prompt string, maxTokens int, stream io.Writer) (string, string, error) {
+	logger.Println("Generating response...")
 
-	options := []llms.CallOption{
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	completion, model, err := c.complete(ctx, system, prompt, stream,
 		llms.WithTemperature(0.7),
-		llms.WithMaxTokens(4096),
+		llms.WithMaxTokens(maxTokens),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	return completion, model, nil
+}
+
+// complete is the single path to the model: it serves recorded completions
+// when replaying, tries each model in the chain until one is available, and
+// saves each exchange when recording. It returns the model that answered.
+func (c *Client) complete(ctx context.Context, system, prompt string, stream io.Writer, options ...llms.CallOption) (string, string, error) {
+	if c.replay != nil {
+		completion, err := c.replay.complete(prompt)
+		if err != nil {
+			return "", "", err
+		}
+		if stream != nil {
+			if _, err := io.WriteString(stream, completion); err != nil {
+				return "", "", err
+			}
+		}
+		return completion, c.ModelName(), nil
+	}
+
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)}
+	if system != "" {
+		messages = append([]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, system)}, messages...)
+	}
+
+	for i, model := range c.models {
+		release, err := acquire(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		completion, err := c.generateStream(ctx, c.llms[i], model, messages, stream, options...)
+		release()
+		if err != nil {
+			err = classifyError(err)
+			if i+1 < len(c.models) && isUnavailable(err) {
+				logger.Warnf("%s is unavailable (%v), falling back to %s\n", model, err, c.models[i+1])
+				continue
+			}
+			return "", "", err
+		}
+
+		if c.recorder != nil {
+			if err := c.recorder.save(system, prompt, completion); err != nil {
+				logger.Warnf("failed to record completion: %v\n", err)
+			}
+		}
+		return completion, model, nil
+	}
+	return "", "", fmt.Errorf("no models configured")
+}
+
+// generateStream is generate that, when stream is non-nil, writes chunks to
+// it as they arrive and counts the tokens streamed so far, warning at
+// SoftTokenCap and cancelling the request at HardTokenCap
+func (c *Client) generateStream(ctx context.Context, m llms.Model, model string, messages []llms.MessageContent, stream io.Writer, options ...llms.CallOption) (string, error) {
+	if stream == nil {
+		return generate(ctx, m, messages, options...)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	streamed, warned := 0, false
+	options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		if _, err := stream.Write(chunk); err != nil {
+			return err
+		}
+		streamed += len(chunk)
+		tokens := streamed / bytesPerToken
+		if c.SoftTokenCap > 0 && tokens > c.SoftTokenCap && !warned {
+			warned = true
+			logger.Warnf("%s has streamed over %d tokens; the output may be runaway\n", model, c.SoftTokenCap)
+		}
+		if c.HardTokenCap > 0 && tokens > c.HardTokenCap {
+			err := fmt.Errorf("%w: %s streamed over %d tokens", ErrTokenCap, model, c.HardTokenCap)
+			cancel(err)
+			return err
+		}
+		return nil
+	}))
+
+	completion, err := generate(ctx, m, messages, options...)
+	if cause := context.Cause(ctx); err != nil && errors.Is(cause, ErrTokenCap) {
+		return "", cause
 	}
+	return completion, err
+}
 
-	completion, err := c.llm.Call(ctx, prompt, options...)
+// generate sends messages to model and returns the text of the first choice
+func generate(ctx context.Context, model llms.Model, messages []llms.MessageContent, options ...llms.CallOption) (string, error) {
+	resp, err := model.GenerateContent(ctx, messages, options...)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate content: %w", err)
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response from model")
 	}
+	return resp.Choices[0].Content, nil
+}
 
-	return completion, nil
+// RecordTo saves every prompt and completion under dir for later replay
+func (c *Client) RecordTo(dir string) error {
+	rec, err := newRecorder(dir)
+	if err != nil {
+		return err
+	}
+	c.recorder = rec
+	return nil
 }
 
-// Add function to get model name
+// ModelName returns the primary model, the first in the fallback chain
 func (c *Client) ModelName() string {
-	return "claude-3-5-sonnet-20240620"
+	return c.models[0]
 }
 
-func NewClient(apiKey string) (*Client, error) {
-	llm, err := anthropic.New(
-		anthropic.WithModel("claude-3-5-sonnet-20241022"),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Anthropic client: %w", err)
+// NewClient creates a client for models on backend, tried in order on each
+// request when a model is overloaded or unavailable.
+func NewClient(backend Backend, models []string, httpClient *http.Client) (*Client, error) {
+	if err := backend.Validate(); err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no model configured")
 	}
 
-	return &Client{
-		llm: llm,
-	}, nil
+	client := &Client{models: models}
+	for _, model := range models {
+		llm, err := backend.newModel(model, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		client.llms = append(client.llms, llm)
+	}
+	return client, nil
+}
+
+// NewReplayClient returns a client that answers from completions recorded
+// with RecordTo, without calling the API.
+func NewReplayClient(dir, model string) (*Client, error) {
+	replay, err := newReplayer(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{models: []string{model}, replay: replay}, nil
 }
 
 func getTotalSize(files map[string]*git.RepoFile) int64 {
@@ -70,30 +240,19 @@ func formatFilesForPrompt(files map[string]*git.RepoFile) string {
 	return fmt.Sprintf("Total size: %d bytes\n\nFiles:\n%s", totalSize, strings.Join(fileList, "\n"))
 }
 
-func (c *Client) SelectFiles(files map[string]*git.RepoFile, maxSize int) ([]string, int64, error) {
-	totalSize := getTotalSize(files)
-
-	// If total size is already under maxSize, return all files
-	if totalSize <= int64(maxSize) {
-		fmt.Printf("Total size (%d bytes) is under limit (%d bytes), including all files\n", totalSize, maxSize)
-		allFiles := make([]string, 0, len(files))
-		for path := range files {
-			allFiles = append(allFiles, path)
-		}
-		return allFiles, totalSize, nil
-	}
-
-	fmt.Printf("Total size (%d bytes) exceeds limit (%d bytes), asking Claude to select files...\n", totalSize, maxSize)
+// SelectionSystemPrompt sets the model's role for file selection
+const SelectionSystemPrompt = `You are selecting the most important files to understand a software project, so that documentation can be written from them. You reply only with file paths from the listing you are given, one per line.`
 
-	fileInfo := formatFilesForPrompt(files)
-
-	prompt := fmt.Sprintf(`You are selecting the most important files to understand a software project, within %d bytes limit.
+// SelectionPrompt is the user prompt that asks the model to choose files
+// within maxSize bytes. It is sent with SelectionSystemPrompt.
+func SelectionPrompt(files map[string]*git.RepoFile, maxSize int) string {
+	return fmt.Sprintf(`Select the most important files to understand this project, within a %d bytes limit.
 
 Repository structure:
 %s
 
 Select files that help understand:
-1. What the project does and its core functionality (especially README.md and any other english language documentation)
+1. What the project does and its core functionality (especially README.md and any other english language documentation)%s
 2. How to use/integrate the project - Especially tutorials and guides
 3. Key configuration needed to make it work
 4. Main implementation details, focusing on:
@@ -108,63 +267,227 @@ Avoid files that are:
 3. Build artifacts and dependencies
 4. Auxiliary documentation (contribution guides, changelogs)
 
-Format: One filepath per line
+Format: One filepath per line, most important first
 Stay under %d bytes total size
-Reply ONLY with filepaths.`, maxSize, fileInfo, maxSize)
-
-	ctx := context.Background()
-
-	fmt.Println("\nWaiting for Claude's response...")
-	completion, err := llms.GenerateFromSinglePrompt(
-		ctx,
-		c.llm,
-		prompt,
-		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-			fmt.Print(string(chunk))
-			return nil
-		}),
-	)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get LLM response: %w", err)
+Reply ONLY with filepaths.`, maxSize, formatFilesForPrompt(files), docGlobsHint(), maxSize)
+}
+
+// docGlobsHint points the model at documentation kept outside the usual
+// places, as configured with --doc-globs
+func docGlobsHint() string {
+	if len(git.DocGlobs()) == 0 {
+		return ""
+	}
+	return "\n   This project's documentation also includes files matching: " + strings.Join(git.DocGlobs(), ", ")
+}
+
+// selectionAttempts bounds how often the model is asked to select files
+// before the heuristic selector is used instead
+const selectionAttempts = 2
+
+// strictSelectionReminder is appended to the selection prompt on a retry
+const strictSelectionReminder = `
+
+Your previous reply contained no usable file paths. Output ONLY file paths, one per line, nothing else: no introduction, numbering, commentary or code fences.`
+
+func (c *Client) SelectFiles(ctx context.Context, files map[string]*git.RepoFile, maxSize int) ([]string, int64, error) {
+	c.missing = nil
+	totalSize := getTotalSize(files)
+
+	// If total size is already under maxSize, return all files
+	if totalSize <= int64(maxSize) {
+		logger.Printf("Total size (%d bytes) is under limit (%d bytes), including all files\n", totalSize, maxSize)
+		allFiles := make([]string, 0, len(files))
+		for path := range files {
+			allFiles = append(allFiles, path)
+		}
+		return allFiles, totalSize, nil
 	}
-	fmt.Println("\n")
 
-	// Process the response
-	selectedFiles := []string{}
-	selectedSize := int64(0)
+	logger.Printf("Total size (%d bytes) exceeds limit (%d bytes), asking Claude to select files...\n", totalSize, maxSize)
+
+	prompt := SelectionPrompt(files, maxSize)
+	defer c.reportMissing()
+
+	// A listing too long for the context window would only be rejected
+	if tokens := (len(SelectionSystemPrompt) + len(prompt)) / bytesPerToken; c.ContextWindow > 0 && tokens+DefaultMaxTokens > c.ContextWindow {
+		logger.Warnf("file listing (~%d tokens) is too large for the %d token context window; using the heuristic selector\n", tokens, c.ContextWindow)
+		return selector.Heuristic{}.SelectFiles(ctx, files, maxSize)
+	}
+
+	// A reply of prose with no usable paths gets one stricter retry, then
+	// the heuristic selector stands in for the model
+	var selectedFiles []string
+	var selectedSize int64
+	for attempt := 1; attempt <= selectionAttempts; attempt++ {
+		if attempt > 1 {
+			logger.Printf("\nRetrying file selection (attempt %d of %d)...\n", attempt, selectionAttempts)
+			prompt += strictSelectionReminder
+		}
+
+		logger.Println("\nWaiting for Claude's response...")
+		completion, _, err := c.complete(ctx, SelectionSystemPrompt, prompt, logger.ProgressWriter())
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get LLM response: %w", err)
+		}
+		logger.Println()
+
+		var missing []string
+		selectedFiles, selectedSize, missing = parseSelection(completion, files, maxSize)
+		c.addMissing(missing)
+		logger.Printf("Selection attempt %d: parsed %d files\n", attempt, len(selectedFiles))
+		if len(selectedFiles) > 0 {
+			break
+		}
+	}
+
+	if len(selectedFiles) == 0 {
+		logger.Warnf("no files were selected within size constraints after %d attempts; falling back to the heuristic selector\n", selectionAttempts)
+		return selector.Heuristic{}.SelectFiles(ctx, files, maxSize)
+	}
+
+	selectedFiles, selectedSize = c.checkUnderSelection(selectedFiles, selectedSize, files, maxSize)
+
+	logger.Printf("\nTotal selected size: %d bytes (%.2f%% of limit)\n",
+		selectedSize, float64(selectedSize)/float64(maxSize)*100)
+
+	return selectedFiles, selectedSize, nil
+}
+
+// MissingPaths returns the paths the model named in the last SelectFiles
+// call that don't exist in the repository and couldn't be corrected
+func (c *Client) MissingPaths() []string {
+	return c.missing
+}
 
-	for _, file := range strings.Split(completion, "\n") {
-		file = strings.TrimSpace(file)
-		if file == "" {
+func (c *Client) addMissing(paths []string) {
+	for _, path := range paths {
+		if !slices.Contains(c.missing, path) {
+			c.missing = append(c.missing, path)
+		}
+	}
+}
+
+// reportMissing warns once about nonexistent paths, as a quality signal: a
+// high rate suggests the file listing confused the model
+func (c *Client) reportMissing() {
+	if len(c.missing) == 0 {
+		return
+	}
+	logger.Warnf("the model named %d files that don't exist (listed with --verbose or --json)\n", len(c.missing))
+}
+
+// normalizeSelectedPath cleans a path echoed by the model so it matches the
+// keys returned by GetFiles, e.g. "./src//main.go" becomes "src/main.go".
+func normalizeSelectedPath(line string) string {
+	file := strings.TrimSpace(line)
+
+	// Extract just the filepath if the LLM included the size
+	if idx := strings.Index(file, " ("); idx != -1 {
+		file = file[:idx]
+	}
+	if file == "" {
+		return ""
+	}
+
+	return filepath.Clean(filepath.FromSlash(file))
+}
+
+// stripCodeFences drops the fence lines, with any language tag, from a reply
+// the model wrapped in a code block, e.g. "```text" ... "```".
+func stripCodeFences(completion string) string {
+	lines := strings.Split(completion, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
 			continue
 		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// parseSelection turns the model's reply into the list of selected files,
+// skipping duplicates and staying within maxSize. Paths that don't exist are
+// corrected when they're an obvious typo of a real one, and otherwise
+// returned as missing.
+func parseSelection(completion string, files map[string]*git.RepoFile, maxSize int) ([]string, int64, []string) {
+	selectedFiles := []string{}
+	selectedSize := int64(0)
+	seen := make(map[string]bool)
+	var missing []string
 
-		// Extract just the filepath if the LLM included the size
-		if idx := strings.Index(file, " ("); idx != -1 {
-			file = file[:idx]
+	for _, line := range strings.Split(stripCodeFences(completion), "\n") {
+		file := normalizeSelectedPath(line)
+		if file == "" || seen[file] {
+			continue
 		}
+		seen[file] = true
 
-		if repoFile, exists := files[file]; exists {
-			if selectedSize+repoFile.Size > int64(maxSize) {
-				fmt.Printf("Skipping %s: would exceed size limit\n", file)
+		if _, exists := files[file]; !exists {
+			corrected, ok := correctPath(file, files)
+			if !ok {
+				logger.Verbosef("File not found: %s\n", file)
+				missing = append(missing, file)
+				continue
+			}
+			logger.Printf("Corrected %s to %s\n", file, corrected)
+			if seen[corrected] {
 				continue
 			}
-			selectedFiles = append(selectedFiles, file)
-			selectedSize += repoFile.Size
-			fmt.Printf("Selected: %s (%d bytes)\n", file, repoFile.Size)
-		} else {
-			fmt.Printf("Warning: File not found: %s\n", file)
+			file = corrected
+			seen[file] = true
 		}
+
+		repoFile := files[file]
+		if selectedSize+repoFile.Size > int64(maxSize) {
+			logger.Printf("Skipping %s: would exceed size limit\n", file)
+			continue
+		}
+		selectedFiles = append(selectedFiles, file)
+		selectedSize += repoFile.Size
+		logger.Printf("Selected: %s (%d bytes)\n", file, repoFile.Size)
 	}
 
-	if len(selectedFiles) == 0 {
-		return nil, 0, fmt.Errorf("no files were selected within size constraints")
+	return selectedFiles, selectedSize, missing
+}
+
+// checkUnderSelection warns when the model used only a small part of the
+// budget while plenty of files were left out, and with TopUp set adds the
+// highest-ranked remaining files until the budget is used.
+func (c *Client) checkUnderSelection(selected []string, size int64, files map[string]*git.RepoFile, maxSize int) ([]string, int64) {
+	floor := int64(c.SelectionFloor * float64(maxSize))
+	remaining := len(files) - len(selected)
+	if size >= floor || remaining < minRemainingCandidates {
+		return selected, size
 	}
 
-	fmt.Printf("\nTotal selected size: %d bytes (%.2f%% of limit)\n",
-		selectedSize, float64(selectedSize)/float64(maxSize)*100)
+	logger.Warnf("selected files use only %.2f%% of the %d byte budget while %d files were left out; documentation may be thin\n",
+		float64(size)/float64(maxSize)*100, maxSize, remaining)
+	if !c.TopUp {
+		return selected, size
+	}
 
-	return selectedFiles, selectedSize, nil
+	chosen := make(map[string]bool, len(selected))
+	for _, path := range selected {
+		chosen[path] = true
+	}
+
+	added := 0
+	for _, path := range selector.Rank(files) {
+		file := files[path]
+		if chosen[path] || size+file.Size > int64(maxSize) {
+			continue
+		}
+		selected = append(selected, path)
+		size += file.Size
+		added++
+		logger.Printf("Topped up: %s (%d bytes)\n", path, file.Size)
+	}
+	logger.Printf("Added %d heuristically ranked files to the selection\n", added)
+
+	return selected, size
 }
 
 func (c *Client) GenerateDocumentation(files map[string]string) (string, error) {
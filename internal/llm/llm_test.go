@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/johnknott/repocontext/internal/git"
+)
+
+func TestNormalizeSelectedPath(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"a.go", "a.go"},
+		{"  a.go  ", "a.go"},
+		{"./a.go", "a.go"},
+		{"a//b.go", filepath.Join("a", "b.go")},
+		{"a/./b.go", filepath.Join("a", "b.go")},
+		{"a/b.go (120 bytes)", filepath.Join("a", "b.go")},
+		{"", ""},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeSelectedPath(tt.line); got != tt.want {
+			t.Errorf("normalizeSelectedPath(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	files := map[string]*git.RepoFile{
+		"a.go":                     {Path: "a.go", Size: 100},
+		filepath.Join("a", "b.go"): {Path: filepath.Join("a", "b.go"), Size: 200},
+		"c.go":                     {Path: "c.go", Size: 300},
+	}
+	ab := filepath.Join("a", "b.go")
+
+	tests := []struct {
+		name       string
+		completion string
+		maxSize    int
+		want       []string
+		wantSize   int64
+	}{
+		{
+			name:       "plain paths",
+			completion: "a.go\na/b.go",
+			maxSize:    1000,
+			want:       []string{"a.go", ab},
+			wantSize:   300,
+		},
+		{
+			name:       "dot prefix",
+			completion: "./a.go",
+			maxSize:    1000,
+			want:       []string{"a.go"},
+			wantSize:   100,
+		},
+		{
+			name:       "doubled slash",
+			completion: "a//b.go",
+			maxSize:    1000,
+			want:       []string{ab},
+			wantSize:   200,
+		},
+		{
+			name:       "repeated path counted once",
+			completion: "a.go\n./a.go\na.go",
+			maxSize:    1000,
+			want:       []string{"a.go"},
+			wantSize:   100,
+		},
+		{
+			name:       "duplicate that would exceed the budget",
+			completion: "c.go\nc.go\na.go",
+			maxSize:    450,
+			want:       []string{"c.go", "a.go"},
+			wantSize:   400,
+		},
+		{
+			name:       "file over the budget skipped",
+			completion: "c.go\na/b.go\na.go",
+			maxSize:    450,
+			want:       []string{"c.go", "a.go"},
+			wantSize:   400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, size, missing := parseSelection(tt.completion, files, tt.maxSize)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selected = %q, want %q", got, tt.want)
+			}
+			if size != tt.wantSize {
+				t.Errorf("selectedSize = %d, want %d", size, tt.wantSize)
+			}
+			if len(missing) != 0 {
+				t.Errorf("missing = %q, want none", missing)
+			}
+		})
+	}
+}
+
+func TestStripCodeFences(t *testing.T) {
+	tests := []struct {
+		name       string
+		completion string
+		want       string
+	}{
+		{"no fences", "a.go\nb.go", "a.go\nb.go"},
+		{"backticks with language", "```text\na.go\n```", "a.go"},
+		{"bare backticks", "```\na.go\nb.go\n```", "a.go\nb.go"},
+		{"tildes", "~~~\na.go\n~~~", "a.go"},
+		{"tildes with language", "~~~text\na.go\n~~~", "a.go"},
+		{"indented fence", "  ```text\na.go\n  ```", "a.go"},
+		{"text around the block", "Here are the files:\n```\na.go\n```\nDone.", "Here are the files:\na.go\nDone."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripCodeFences(tt.completion); got != tt.want {
+				t.Errorf("stripCodeFences(%q) = %q, want %q", tt.completion, got, tt.want)
+			}
+		})
+	}
+
+	// The fences must not reach the selection as paths
+	files := map[string]*git.RepoFile{"a.go": {Path: "a.go", Size: 10}}
+	for _, completion := range []string{"```text\na.go\n```", "~~~\na.go\n~~~"} {
+		selected, _, missing := parseSelection(completion, files, 100)
+		if !slices.Equal(selected, []string{"a.go"}) || len(missing) != 0 {
+			t.Errorf("parseSelection(%q) = %q, missing %q; want [a.go] and none missing", completion, selected, missing)
+		}
+	}
+}
+
+func TestBackendValidateBedrock(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE"} {
+		t.Setenv(name, "")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	backend := Backend{Provider: ProviderBedrock, Region: "us-east-1"}
+	if err := backend.Validate(); err == nil {
+		t.Error("Validate passed without AWS credentials")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if err := backend.Validate(); err != nil {
+		t.Errorf("Validate with keys: %v", err)
+	}
+	if err := (Backend{Provider: ProviderBedrock}).Validate(); err == nil {
+		t.Error("Validate passed without a region")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if err := os.MkdirAll(filepath.Join(home, ".aws"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".aws", "credentials"), []byte("[default]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Validate(); err != nil {
+		t.Errorf("Validate with a shared credentials file: %v", err)
+	}
+}
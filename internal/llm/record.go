@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+const (
+	systemSuffix     = ".system.txt"
+	promptSuffix     = ".prompt.txt"
+	completionSuffix = ".completion.txt"
+)
+
+// recorder saves every prompt and completion to a directory, one pair of
+// files per call (plus the system message, if any), named so they sort in
+// call order.
+type recorder struct {
+	mu  sync.Mutex
+	dir string
+	seq int
+}
+
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &recorder{dir: dir}, nil
+}
+
+func (r *recorder) save(system, prompt, completion string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	name := fmt.Sprintf("%s-%04d", time.Now().UTC().Format("20060102T150405.000"), r.seq)
+	if system != "" {
+		if err := os.WriteFile(filepath.Join(r.dir, name+systemSuffix), []byte(system), 0644); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, name+promptSuffix), []byte(prompt), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, name+completionSuffix), []byte(completion), 0644)
+}
+
+// replayer serves completions saved by a recorder instead of calling the
+// API. A recording with the same prompt is preferred, so runs that generate
+// sections in parallel replay correctly; otherwise recordings are served in
+// the order they were made.
+type replayer struct {
+	mu    sync.Mutex
+	dir   string
+	names []string
+	used  []bool
+}
+
+func newReplayer(dir string) (*replayer, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+completionSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no recorded completions found in %s", dir)
+	}
+	sort.Strings(matches)
+
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = strings.TrimSuffix(filepath.Base(match), completionSuffix)
+	}
+	return &replayer{dir: dir, names: names, used: make([]bool, len(names))}, nil
+}
+
+func (r *replayer) complete(prompt string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := -1
+	for i, name := range r.names {
+		if r.used[i] {
+			continue
+		}
+		if next == -1 {
+			next = i
+		}
+		if recorded, err := os.ReadFile(filepath.Join(r.dir, name+promptSuffix)); err == nil && string(recorded) == prompt {
+			next = i
+			break
+		}
+	}
+	if next == -1 {
+		return "", fmt.Errorf("no more recorded completions in %s (replayed %d)", r.dir, len(r.names))
+	}
+	r.used[next] = true
+	name := r.names[next]
+
+	// A changed prompt is expected while tuning prompts, so only mention it
+	if recorded, err := os.ReadFile(filepath.Join(r.dir, name+promptSuffix)); err == nil && string(recorded) != prompt {
+		logger.Verbosef("Prompt differs from recording %s\n", name)
+	}
+
+	completion, err := os.ReadFile(filepath.Join(r.dir, name+completionSuffix))
+	if err != nil {
+		return "", fmt.Errorf("failed to read recorded completion: %w", err)
+	}
+	return string(completion), nil
+}
@@ -0,0 +1,106 @@
+// Package logger provides the leveled console output shared by the CLI and
+// the internal packages, so --quiet and --verbose apply everywhere.
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Level int
+
+const (
+	LevelQuiet Level = iota
+	LevelNormal
+	LevelVerbose
+)
+
+var (
+	level           = LevelNormal
+	out   io.Writer = os.Stdout
+
+	warningsMu sync.Mutex
+	warnings   []string
+)
+
+func SetLevel(l Level) {
+	level = l
+}
+
+func SetOutput(w io.Writer) {
+	out = w
+}
+
+func IsVerbose() bool {
+	return level >= LevelVerbose
+}
+
+// Printf writes progress output unless running quietly
+func Printf(format string, args ...any) {
+	if level >= LevelNormal {
+		fmt.Fprintf(out, format, args...)
+	}
+}
+
+func Println(args ...any) {
+	if level >= LevelNormal {
+		fmt.Fprintln(out, args...)
+	}
+}
+
+// Verbosef writes output only shown with --verbose
+func Verbosef(format string, args ...any) {
+	if level >= LevelVerbose {
+		fmt.Fprintf(out, format, args...)
+	}
+}
+
+// Warnf always writes to stderr, regardless of level, and keeps the
+// message for Warnings.
+func Warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprint(os.Stderr, "Warning: "+msg)
+
+	warningsMu.Lock()
+	warnings = append(warnings, strings.TrimSpace(msg))
+	warningsMu.Unlock()
+}
+
+// Problemf reports a file that couldn't be read or classified. Normally
+// it's a warning and Problemf returns nil, so the run carries on without the
+// file; when strict, nothing is printed and the message is returned as an
+// error for the caller to fail with.
+func Problemf(strict bool, format string, args ...any) error {
+	if strict {
+		return errors.New(strings.TrimSpace(fmt.Sprintf(format, args...)))
+	}
+	Warnf(format, args...)
+	return nil
+}
+
+// Warnings returns the messages passed to Warnf since the last ResetWarnings
+func Warnings() []string {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	return append([]string(nil), warnings...)
+}
+
+// ResetWarnings forgets collected warnings, e.g. at the start of a run
+func ResetWarnings() {
+	warningsMu.Lock()
+	warnings = nil
+	warningsMu.Unlock()
+}
+
+// ProgressWriter returns the writer for raw progress streams (e.g. git clone
+// progress), or nil when progress output is disabled.
+func ProgressWriter() io.Writer {
+	if level < LevelNormal {
+		return nil
+	}
+	return out
+}
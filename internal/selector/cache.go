@@ -0,0 +1,84 @@
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/johnknott/repocontext/internal/git"
+)
+
+// CacheFileName holds the last selection, next to the generated docs
+const CacheFileName = "selection.json"
+
+// cachedSelection is a selection and the inputs it was made from
+type cachedSelection struct {
+	CommitHash string   `json:"commit_hash"`
+	MaxSize    int      `json:"max_size"`
+	Files      []string `json:"files"`
+}
+
+// LoadCache returns the selection saved in dir for the same commit and size
+// limit, so the model isn't asked again. It reports false when there is no
+// usable cache, including when a cached file is no longer documentable.
+func LoadCache(dir, commitHash string, maxSize int, files map[string]*git.RepoFile) ([]string, int64, bool) {
+	cached, ok := readCache(dir, commitHash)
+	if !ok || cached.MaxSize != maxSize {
+		return nil, 0, false
+	}
+
+	var size int64
+	for _, path := range cached.Files {
+		file, ok := files[path]
+		if !ok {
+			return nil, 0, false
+		}
+		size += file.Size
+	}
+	return cached.Files, size, true
+}
+
+// CachedFiles returns the selection saved in dir for the commit, whatever
+// size limit and file filters it was made with, for comparing against a new
+// selection
+func CachedFiles(dir, commitHash string) ([]string, bool) {
+	cached, ok := readCache(dir, commitHash)
+	return cached.Files, ok
+}
+
+// readCache reads a non-empty selection saved in dir for the commit
+func readCache(dir, commitHash string) (cachedSelection, bool) {
+	var cached cachedSelection
+	data, err := os.ReadFile(filepath.Join(dir, CacheFileName))
+	if err != nil {
+		return cached, false
+	}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return cached, false
+	}
+	if cached.CommitHash != commitHash || len(cached.Files) == 0 {
+		return cached, false
+	}
+	return cached, true
+}
+
+// SaveCache records a selection for LoadCache
+func SaveCache(dir, commitHash string, maxSize int, selected []string) error {
+	data, err := json.MarshalIndent(cachedSelection{
+		CommitHash: commitHash,
+		MaxSize:    maxSize,
+		Files:      selected,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal selection: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create docs directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, CacheFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write selection cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/logger"
+)
+
+// Manifest selects exactly the listed files, for reproducible docs. Root is
+// the directory the paths are relative to, used to explain why a listed file
+// is unavailable.
+type Manifest struct {
+	Paths []string
+	Root  string
+}
+
+// ReadManifest reads a newline-delimited list of repository-relative paths.
+// Blank lines and lines starting with # are ignored.
+func ReadManifest(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("file list %s is empty", path)
+	}
+	return paths, nil
+}
+
+func (m Manifest) SelectFiles(ctx context.Context, files map[string]*git.RepoFile, maxSize int) ([]string, int64, error) {
+	var selected []string
+	var size int64
+	var errs []error
+	seen := make(map[string]bool)
+	for _, listed := range m.Paths {
+		path := filepath.Clean(filepath.FromSlash(listed))
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		file, ok := files[path]
+		if !ok {
+			errs = append(errs, m.unavailable(listed, path))
+			continue
+		}
+		selected = append(selected, path)
+		size += file.Size
+	}
+	if len(errs) > 0 {
+		return nil, 0, fmt.Errorf("invalid file list: %w", errors.Join(errs...))
+	}
+
+	// The list is used as given, so going over the budget only warns
+	if size > int64(maxSize) {
+		logger.Warnf("listed files total %d bytes, over the %d byte limit\n", size, maxSize)
+	}
+	return selected, size, nil
+}
+
+// unavailable explains why a listed path isn't among the documentable files
+func (m Manifest) unavailable(listed, path string) error {
+	if m.Root != "" {
+		if _, err := os.Stat(filepath.Join(m.Root, path)); err == nil {
+			return fmt.Errorf("%s is binary, ignored or excluded", listed)
+		}
+	}
+	return fmt.Errorf("%s does not exist", listed)
+}
@@ -0,0 +1,174 @@
+// Package selector ranks repository files by how useful they are likely to
+// be for understanding a project, without asking the model.
+package selector
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/johnknott/repocontext/internal/git"
+)
+
+// FileSelector picks which files to document within a byte budget,
+// returning the chosen paths and their total size. Cancelling ctx stops a
+// selection that asks a model.
+type FileSelector interface {
+	SelectFiles(ctx context.Context, files map[string]*git.RepoFile, maxSize int) ([]string, int64, error)
+}
+
+// largeFileSize is the size above which a file is ranked lower, since it
+// uses a lot of the budget for one file.
+const largeFileSize = 50000
+
+// entryPoints are file names that usually start a program or package
+var entryPoints = map[string]bool{
+	"main.go":     true,
+	"main.py":     true,
+	"__main__.py": true,
+	"app.py":      true,
+	"main.rs":     true,
+	"lib.rs":      true,
+	"index.js":    true,
+	"index.ts":    true,
+	"main.js":     true,
+	"main.ts":     true,
+	"main.c":      true,
+	"main.cpp":    true,
+	"program.cs":  true,
+}
+
+// manifests describe dependencies and how the project is built
+var manifests = map[string]bool{
+	"go.mod":           true,
+	"package.json":     true,
+	"pyproject.toml":   true,
+	"setup.py":         true,
+	"requirements.txt": true,
+	"cargo.toml":       true,
+	"gemfile":          true,
+	"pom.xml":          true,
+	"build.gradle":     true,
+	"makefile":         true,
+	"dockerfile":       true,
+}
+
+// Score rates a file's likely importance; higher is better
+func Score(path string, size int64) int {
+	score, _ := explain(path, size)
+	return score
+}
+
+// Importance is a selected file's score and the kind of file that earned it
+type Importance struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Rank   int    `json:"rank"` // 1-based position in the selection
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Explain scores the selected files, keeping selection order, which for a
+// model's selection is its own order of importance. Scores come from Score,
+// so files chosen by the model and by the heuristic compare directly and
+// show which files sit on the margin of the size limit.
+func Explain(selected []string, files map[string]*git.RepoFile) []Importance {
+	importance := make([]Importance, 0, len(selected))
+	for i, path := range selected {
+		file, ok := files[path]
+		if !ok {
+			continue
+		}
+		score, reason := explain(path, file.Size)
+		importance = append(importance, Importance{Path: path, Size: file.Size, Rank: i + 1, Score: score, Reason: reason})
+	}
+	return importance
+}
+
+// explain scores a file and names the rule that scored it
+func explain(path string, size int64) (int, string) {
+	path = filepath.ToSlash(path)
+	base := strings.ToLower(filepath.Base(path))
+	depth := strings.Count(path, "/")
+
+	var score int
+	var reason string
+	switch {
+	case strings.HasPrefix(base, "readme"):
+		score, reason = 60, "readme"
+		if depth == 0 {
+			score, reason = 100, "top-level readme"
+		}
+	case git.IsDocFile(path):
+		score, reason = 40, "documentation"
+		if strings.HasPrefix(path, "docs/") || strings.HasPrefix(path, "doc/") {
+			score = 50
+		}
+		// Configured documentation often sits deep in a site's tree
+		if git.MatchesDocGlobs(path) {
+			score, reason = 55, "configured documentation"
+		}
+	case entryPoints[base] || strings.HasPrefix(path, "cmd/"):
+		score, reason = 45, "entry point"
+	case manifests[base]:
+		score, reason = 35, "manifest"
+	case git.LanguageOf(path) != "":
+		score, reason = 20, "source"
+	default:
+		score, reason = 5, "other"
+	}
+
+	// Prefer files near the root, and don't let one huge file crowd out others
+	score -= 2 * depth
+	if size > largeFileSize {
+		score -= 10
+		reason += ", large"
+	}
+	return score, reason
+}
+
+// Rank returns the paths of files ordered from most to least important.
+// Ties are broken by size, then path, so the order is stable.
+func Rank(files map[string]*git.RepoFile) []string {
+	paths := make([]string, 0, len(files))
+	scores := make(map[string]int, len(files))
+	for path, file := range files {
+		paths = append(paths, path)
+		scores[path] = Score(path, file.Size)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := paths[i], paths[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		if files[a].Size != files[b].Size {
+			return files[a].Size < files[b].Size
+		}
+		return a < b
+	})
+	return paths
+}
+
+// Heuristic selects files by Rank without asking a model
+type Heuristic struct{}
+
+func (Heuristic) SelectFiles(ctx context.Context, files map[string]*git.RepoFile, maxSize int) ([]string, int64, error) {
+	var selected []string
+	var size int64
+	for _, path := range Rank(files) {
+		file := files[path]
+		if size+file.Size > int64(maxSize) {
+			continue
+		}
+		selected = append(selected, path)
+		size += file.Size
+	}
+
+	if len(selected) == 0 {
+		return nil, 0, fmt.Errorf("no files were selected within size constraints")
+	}
+	return selected, size, nil
+}
@@ -0,0 +1,60 @@
+package repocontext
+
+import (
+	"errors"
+
+	"github.com/johnknott/repocontext/internal/docs"
+)
+
+// Stage identifies which part of the pipeline an error came from, so
+// callers can react differently to bad settings, clone failures and so on.
+type Stage int
+
+const (
+	StageUnknown    Stage = iota
+	StageConfig           // invalid options or configuration
+	StageGit              // clone, fetch or other git/network failure
+	StageLLM              // model call or generation failure
+	StageFilesystem       // reading or writing docs
+	StageLinks            // broken links in the docs with StrictLinks
+)
+
+// Error is returned by Generate and Check for every failure
+type Error struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func configError(err error) error {
+	return &Error{Stage: StageConfig, Err: err}
+}
+
+func gitError(err error) error {
+	return &Error{Stage: StageGit, Err: err}
+}
+
+func fsError(err error) error {
+	return &Error{Stage: StageFilesystem, Err: err}
+}
+
+func linksError(err error) error {
+	return &Error{Stage: StageLinks, Err: err}
+}
+
+// llmError tags a failed generation step. Generation also reads and writes
+// docs, so a filesystem error inside it is reported as one.
+func llmError(err error) error {
+	var fileErr *docs.FileError
+	if errors.As(err, &fileErr) {
+		return fsError(err)
+	}
+	return &Error{Stage: StageLLM, Err: err}
+}
@@ -0,0 +1,978 @@
+// Package repocontext generates LLM-ready documentation for GitHub
+// repositories. It is the library behind the repocontext command: Generate
+// clones a repository, selects the files that fit the context budget, and
+// writes overview, getting started and usage docs.
+package repocontext
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnknott/repocontext/internal/config"
+	"github.com/johnknott/repocontext/internal/docs"
+	"github.com/johnknott/repocontext/internal/git"
+	"github.com/johnknott/repocontext/internal/httpclient"
+	"github.com/johnknott/repocontext/internal/llm"
+	"github.com/johnknott/repocontext/internal/logger"
+	"github.com/johnknott/repocontext/internal/selector"
+)
+
+type (
+	// Config holds every setting; see LoadConfig for how it's resolved
+	Config = config.Config
+	// Metadata describes a generated set of docs
+	Metadata = docs.Metadata
+	// RepoFile is a file found in the repository
+	RepoFile = git.RepoFile
+	// FileSelector picks which files fit the context budget
+	FileSelector = selector.FileSelector
+	// HeuristicSelector picks files without calling the model
+	HeuristicSelector = selector.Heuristic
+	// Prompt is an assembled prompt and the file it would produce
+	Prompt = docs.Prompt
+	// LinkProblem is a broken link found in the generated docs
+	LinkProblem = docs.LinkProblem
+	// Section is one generated section of the documentation
+	Section = docs.Section
+	// CitationProblem is a cited excerpt that doesn't match the source
+	CitationProblem = docs.CitationProblem
+	// Manifest is a machine-readable description of the repository
+	Manifest = docs.Manifest
+	// Importance is a selected file's score and why it was chosen
+	Importance = selector.Importance
+)
+
+// LoadConfig returns the configuration from defaults, config files and
+// environment variables, the same way the CLI resolves it.
+func LoadConfig() (*Config, error) {
+	return config.New()
+}
+
+// ReadFileList reads a newline-delimited list of repository-relative paths
+// for Options.Files, ignoring blank lines and # comments.
+func ReadFileList(path string) ([]string, error) {
+	return selector.ReadManifest(path)
+}
+
+// Options controls a single Generate or Check call
+type Options struct {
+	Repo    string  // user/repo[@tag|@commit|#branch][:subpath], or a .tar.gz/.tgz/.zip URL
+	Config  *Config // nil means LoadConfig()
+	Branch  string  // overrides a #branch in Repo
+	Commit  string  // full commit SHA, overrides an @ref in Repo
+	Subpath string  // overrides a :subpath in Repo
+
+	ForceClone bool // delete any existing clone and clone afresh
+	Ephemeral  bool // clone and generate in a temporary directory removed before returning
+
+	Selector    FileSelector // nil lets the model choose files
+	Files       []string     // use exactly these repository-relative paths, instead of Selector
+	SelectOnly  bool         // stop after selecting files
+	SummaryOnly bool         // write a one-paragraph summary.md instead of the full docs
+	PromptsOnly bool         // build the prompts into Result.Prompts without calling the model
+	Record      string       // save prompts and completions to this directory
+	Replay      string       // answer from recordings instead of calling the API
+	SLOCStrict  bool         // skip blank and comment-only lines in line counts
+	Frontmatter bool         // prepend YAML frontmatter to doc files
+	Stream      io.Writer    // if set, sections are echoed here as they're generated
+	Since       time.Time    // reuse cached docs if the latest commit is older than this
+	Compare     []string     // two models to generate the sections with side by side, for evaluation
+	PostProcess string       // shell command full.md is piped through after the cleanup pass; its output replaces it
+
+	// RefreshSelection selects files afresh instead of reusing the cached
+	// selection, and reports how the new one differs. Cached docs are kept
+	// if the selected set is unchanged, and regenerated if it changed.
+	RefreshSelection bool
+
+	// Manifest also writes manifest.json, a machine-readable description of
+	// the repository's entry points, directories, languages and dependencies
+	Manifest bool
+
+	// NoRepoConfig ignores a .repocontext.yaml at the root of the documented
+	// repository, which otherwise supplies settings the caller hasn't set
+	NoRepoConfig bool
+}
+
+// Result is the outcome of Generate
+type Result struct {
+	Repository  string               // the Repo option as given
+	DocsPath    string               // directory holding the generated files; empty with Ephemeral
+	VersionPath string               // user/repo/versions/<commit>/<settings hash>
+	Markdown    string               // the combined documentation (full.md), or summary.md with SummaryOnly
+	Sections    []Section            // the individual sections, in document order; nil with SummaryOnly
+	Metadata    *Metadata            // nil with SelectOnly
+	Selected    []string             // paths given to the model, in selection order
+	Files       map[string]*RepoFile // every documentable file found, keyed by path, less identical copies
+	Cached      bool                 // docs were reused because of Since
+	Warnings    []string             // warnings printed during the run
+	Missing     []string             // paths the model selected that don't exist in the repository
+	BrokenLinks []LinkProblem        // links in full.md that don't resolve, when checked
+	Compared    []string             // with Compare: the section files written, each model in turn
+	Prompts     []Prompt             // with PromptsOnly: selection (if needed) and section prompts
+
+	// Importance scores each selected file, in selection order
+	Importance []Importance
+
+	// With CiteSource: excerpts in full.md that don't match the source
+	Citations []CitationProblem
+
+	// With the Manifest option: the contents of manifest.json
+	Manifest *Manifest
+
+	// With RefreshSelection: how the new selection differs from the cached one
+	SelectionAdded   []string
+	SelectionRemoved []string
+}
+
+// limitOnce applies the first run's MaxConcurrency: the limit is shared by
+// the whole process, so it isn't replaced while requests may be in flight
+var limitOnce sync.Once
+
+// Generate clones or updates the repository, selects files, generates the
+// documentation and removes duplication, returning the markdown and its
+// metadata. Errors are *Error values identifying the failing stage.
+//
+// Generate is not safe for concurrent use: it resets the process-wide
+// warning log, routes all git HTTP requests through the run's proxy
+// settings and sets the documentation globs for the whole process. Run one
+// Generate or Check at a time.
+func Generate(ctx context.Context, opts Options) (*Result, error) {
+	logger.ResetWarnings()
+	result, err := generate(ctx, opts)
+	if result != nil {
+		result.Warnings = logger.Warnings()
+	}
+	return result, err
+}
+
+func generate(ctx context.Context, opts Options) (*Result, error) {
+	cfg, err := resolveConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing outlives an ephemeral run except the returned markdown
+	if opts.Ephemeral {
+		tmpDir, err := os.MkdirTemp("", "repocontext-")
+		if err != nil {
+			return nil, fsError(fmt.Errorf("failed to create temporary directory: %w", err))
+		}
+		defer os.RemoveAll(tmpDir)
+
+		tmpCfg := *cfg
+		tmpCfg.RepoDir = tmpDir
+		tmpCfg.DocsDir = ""
+		cfg = &tmpCfg
+	}
+
+	settings, err := resolveDocSettings(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	redactPatterns, err := docs.CompileRedactPatterns(append(docs.DefaultRedactPatterns, cfg.RedactPatterns...))
+	if err != nil {
+		return nil, configError(err)
+	}
+	if opts.Record != "" && opts.Replay != "" {
+		return nil, configError(errors.New("recording cannot be combined with replaying"))
+	}
+
+	if len(opts.Compare) > 0 {
+		if len(opts.Compare) != 2 || opts.Compare[0] == opts.Compare[1] {
+			return nil, configError(errors.New("comparing needs two different models"))
+		}
+		if opts.SummaryOnly || opts.SelectOnly || opts.PromptsOnly || opts.Record != "" || opts.Replay != "" {
+			return nil, configError(errors.New("comparing models cannot be combined with summaries, selection only, prompt dumps, recording or replaying"))
+		}
+	}
+
+	if opts.PostProcess != "" && (opts.SummaryOnly || len(opts.Compare) > 0) {
+		return nil, configError(errors.New("post-processing cannot be combined with summaries or comparing models, which don't write full.md"))
+	}
+	if opts.Manifest && (opts.SummaryOnly || opts.SelectOnly || opts.PromptsOnly || len(opts.Compare) > 0) {
+		return nil, configError(errors.New("a manifest cannot be combined with summaries, selection only, prompt dumps or comparing models"))
+	}
+
+	if opts.RefreshSelection && len(opts.Files) > 0 {
+		return nil, configError(errors.New("refreshing the selection cannot be combined with a file list"))
+	}
+
+	if len(opts.Files) > 0 && opts.Selector != nil {
+		return nil, configError(errors.New("a file list cannot be combined with a selector"))
+	}
+
+	// Dumping prompts never calls the model, so files are chosen heuristically
+	if opts.PromptsOnly && opts.Selector == nil && len(opts.Files) == 0 {
+		opts.Selector = HeuristicSelector{}
+	}
+
+	// A select-only run that doesn't ask the model for files never calls it
+	offline := opts.PromptsOnly || opts.SelectOnly && (opts.Selector != nil || len(opts.Files) > 0)
+	if opts.Replay == "" && !offline {
+		if err := cfg.Backend().Validate(); err != nil {
+			return nil, configError(err)
+		}
+	}
+
+	httpClient, err := httpclient.New(cfg.Proxy)
+	if err != nil {
+		return nil, configError(err)
+	}
+	git.UseHTTPClient(httpClient)
+	limitOnce.Do(func() { llm.SetMaxConcurrency(cfg.MaxConcurrency) })
+
+	repo, repoPath, commitHash, err := checkout(ctx, opts, cfg)
+	if err != nil {
+		return nil, err
+	}
+	repo.SLOCStrict = opts.SLOCStrict
+	if !opts.NoRepoConfig {
+		cfg, settings = applyRepoConfig(cfg, settings, repo, repoPath)
+	}
+
+	fileSelector := opts.Selector
+	var client *llm.Client
+	if !offline {
+		if opts.Replay != "" {
+			logger.Printf("Replaying recorded completions from %s...\n", opts.Replay)
+			client, err = llm.NewReplayClient(opts.Replay, cfg.Model)
+		} else {
+			logger.Printf("Initializing %s client...\n", cfg.Provider)
+			client, err = llm.NewClient(cfg.Backend(), cfg.ModelChain(), httpClient)
+		}
+		if err != nil {
+			return nil, configError(err)
+		}
+		if opts.Record != "" {
+			if err := client.RecordTo(opts.Record); err != nil {
+				return nil, fsError(err)
+			}
+		}
+		client.SelectionFloor = cfg.SelectionFloor
+		client.TopUp = cfg.TopUp
+		client.ContextWindow = cfg.EffectiveContextWindow()
+		client.SoftTokenCap = cfg.SoftTokenCap
+		client.HardTokenCap = cfg.HardTokenCap
+		if fileSelector == nil {
+			fileSelector = client
+		}
+	}
+	if len(opts.Files) > 0 {
+		fileSelector = selector.Manifest{Paths: opts.Files, Root: repo.RootPath()}
+	}
+
+	result := &Result{
+		Repository:  opts.Repo,
+		VersionPath: filepath.Join(repo.User, repo.Repo, "versions", commitHash, cacheNamespace(cfg)),
+		DocsPath:    resolveDocsPath(cfg, repo, repoPath, commitHash),
+	}
+
+	// Skip regeneration entirely if nothing was committed since the cutoff
+	if !opts.Since.IsZero() && !opts.SummaryOnly && !opts.PromptsOnly && len(opts.Compare) == 0 {
+		commitTime, err := repo.GetLatestCommitTime()
+		if err != nil {
+			return nil, gitError(err)
+		}
+		if meta, err := docs.LoadMetadata(result.DocsPath); err == nil && commitTime.Before(opts.Since) && loadManifest(opts, result) {
+			logger.Printf("Latest commit (%s) is older than %s, reusing cached documentation\n",
+				commitTime.Format(time.RFC3339), opts.Since.Format(time.RFC3339))
+			result.Metadata = meta
+			result.Cached = true
+			return result, readMarkdown(result)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, gitError(err)
+	}
+
+	// Get file listing
+	logger.Println("\nScanning repository files...")
+	files, err := repo.GetFiles()
+	if err != nil {
+		return nil, fsError(err)
+	}
+	logger.Printf("Found %d files\n", len(files))
+	if len(files) == 0 {
+		return nil, configError(fmt.Errorf("no documentable files found in %s (the repository is empty or every file was binary, ignored or excluded)", opts.Repo))
+	}
+	totalLines, linesByLanguage := git.LineCounts(files)
+
+	// Identical copies would only spend the budget twice on the same content.
+	// A pinned file list is used as given.
+	var identical map[string][]string
+	if len(opts.Files) == 0 {
+		identical = repo.DedupeIdentical(files)
+		if n := countCopies(identical); n > 0 {
+			logger.Printf("Skipping %d byte-identical copies of other files\n", n)
+		}
+	}
+	result.Files = files
+	logger.Printf("Lines of code: %d (%s)\n", totalLines, formatLineCounts(linesByLanguage))
+
+	// Select files to analyze, reusing the last selection for this commit and
+	// size limit so a cache-hit run doesn't ask the model again. A pinned file
+	// list is always used as given.
+	logger.Printf("\nSelecting files to include (max size: %d bytes)...\n", cfg.MaxContextSize)
+	var selectedFiles []string
+	var totalSize int64
+	cached := false
+	var previous []string
+	hadPrevious := false
+	if opts.RefreshSelection {
+		previous, hadPrevious = selector.CachedFiles(result.DocsPath, commitHash)
+	} else if len(opts.Files) == 0 {
+		selectedFiles, totalSize, cached = selector.LoadCache(result.DocsPath, commitHash, cfg.MaxContextSize, files)
+	}
+	switch {
+	case cached:
+		logger.Println("Using cached file selection...")
+	case len(opts.Files) > 0:
+		if selectedFiles, totalSize, err = fileSelector.SelectFiles(ctx, files, cfg.MaxContextSize); err != nil {
+			return nil, configError(err)
+		}
+	case opts.PromptsOnly:
+		// Not cached, so a heuristic choice can't stand in for the model's later
+		if selectedFiles, totalSize, err = fileSelector.SelectFiles(ctx, files, cfg.MaxContextSize); err != nil {
+			return nil, llmError(err)
+		}
+	default:
+		if selectedFiles, totalSize, err = fileSelector.SelectFiles(ctx, files, cfg.MaxContextSize); err != nil {
+			return nil, llmError(err)
+		}
+		// A refreshed selection only previewed with SelectOnly must not
+		// replace the one the cached docs were built from
+		if !opts.RefreshSelection || !opts.SelectOnly {
+			if err := selector.SaveCache(result.DocsPath, commitHash, cfg.MaxContextSize, selectedFiles); err != nil {
+				logger.Warnf("%v\n", err)
+			}
+		}
+	}
+	logger.Printf("\nSelected %d files for analysis (total size: %d bytes)\n", len(selectedFiles), totalSize)
+	result.Selected = selectedFiles
+	result.Importance = selector.Explain(selectedFiles, files)
+	for _, file := range result.Importance {
+		logger.Verbosef("  %3d  %s (%d bytes, %s)\n", file.Score, filepath.ToSlash(file.Path), file.Size, file.Reason)
+	}
+	if client != nil {
+		result.Missing = client.MissingPaths()
+	}
+
+	selectionChanged := false
+	if opts.RefreshSelection && !hadPrevious {
+		logger.Println("No cached selection for this commit to compare with")
+	}
+	if hadPrevious {
+		result.SelectionAdded, result.SelectionRemoved = diffSelection(previous, selectedFiles)
+		selectionChanged = len(result.SelectionAdded) > 0 || len(result.SelectionRemoved) > 0
+		reportSelectionChanges(result.SelectionAdded, result.SelectionRemoved)
+
+		if !selectionChanged && !opts.SelectOnly && !opts.SummaryOnly && !opts.PromptsOnly && len(opts.Compare) == 0 {
+			if meta, err := docs.LoadMetadata(result.DocsPath); err == nil && loadManifest(opts, result) {
+				logger.Println("Selection unchanged, keeping the cached documentation")
+				result.Metadata = meta
+				result.Cached = true
+				return result, readMarkdown(result)
+			}
+		}
+	}
+
+	if opts.SelectOnly {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, llmError(err)
+	}
+
+	// Create filtered map of selected files
+	selectedFilesMap := make(map[string]*git.RepoFile)
+	for _, path := range selectedFiles {
+		selectedFilesMap[path] = files[path]
+	}
+
+	// Initialize documentation generator with versioned path
+	docGen, err := docs.New(repo.RootPath(), result.DocsPath, client)
+	if err != nil {
+		return nil, fsError(err)
+	}
+	if selectionChanged && !opts.PromptsOnly && len(opts.Compare) == 0 {
+		logger.Println("Selection changed, regenerating the documentation")
+		if err := docGen.DiscardCache(); err != nil {
+			return nil, fsError(err)
+		}
+	}
+	docGen.SectionRetries = cfg.SectionRetries
+	docGen.Sections = settings.sections
+	docGen.FullSections = settings.fullSections
+	docGen.DedupThreshold = cfg.DedupThreshold
+	docGen.MaxTokens = llm.DefaultMaxTokens
+	docGen.SectionTokens = settings.sectionTokens
+	docGen.ContextWindow = cfg.EffectiveContextWindow()
+	docGen.Frontmatter = opts.Frontmatter
+	docGen.Instructions = cfg.ExtraInstructions
+	docGen.Language = settings.language
+	docGen.Identical = identical
+	if cfg.BinaryNames {
+		docGen.Binaries = repo.BinaryFiles()
+	}
+	docGen.RepoName = repo.User + "/" + repo.Repo
+	docGen.Redact = redactPatterns
+	docGen.StripComments = cfg.StripComments
+	docGen.Strict = cfg.Strict
+	docGen.CiteSource = cfg.CiteSource
+	docGen.TruncateSize = cfg.TruncateSize
+	docGen.Parallel = cfg.MaxConcurrency > 1
+	docGen.Stream = opts.Stream
+	if slices.Contains(docGen.Sections, docs.ChangelogFileName) {
+		docGen.Sections, docGen.Commits = changelogCommits(repo, cfg.History, docGen.Sections)
+	}
+	if cfg.Authors && slices.Contains(docGen.Sections, docs.OverviewFileName) {
+		docGen.Authors = fileAuthors(repo, cfg, selectedFiles)
+	}
+
+	if len(opts.Compare) > 0 {
+		// Only the overview unless sections were chosen
+		if len(cfg.Sections) == 0 {
+			docGen.Sections = []string{docs.OverviewFileName}
+		}
+		if result.Compared, err = compareModels(ctx, docGen, cfg, opts.Compare, httpClient, selectedFilesMap); err != nil {
+			return nil, llmError(err)
+		}
+		return result, nil
+	}
+
+	if opts.PromptsOnly {
+		if !cached && len(opts.Files) == 0 && totalFileSize(files) > int64(cfg.MaxContextSize) {
+			result.Prompts = append(result.Prompts, Prompt{
+				Name:   "selection",
+				System: llm.SelectionSystemPrompt,
+				Text:   llm.SelectionPrompt(files, cfg.MaxContextSize),
+			})
+		}
+		prompts, err := docGen.Prompts(selectedFilesMap, opts.SummaryOnly)
+		if err != nil {
+			return nil, fsError(err)
+		}
+		result.Prompts = append(result.Prompts, prompts...)
+		return result, nil
+	}
+
+	if cfg.Incremental {
+		docGen.SummaryDir = filepath.Join(repo.Path, "summaries")
+	}
+
+	// Generate or load documentation
+	meta := &docs.Metadata{
+		CommitHash:  commitHash,
+		ModelUsed:   client.ModelName(),
+		GeneratedAt: time.Now(),
+
+		TotalLines:      totalLines,
+		LinesByLanguage: linesByLanguage,
+	}
+
+	if opts.SummaryOnly {
+		summary, err := docGen.GenerateSummary(ctx, selectedFilesMap, meta)
+		if err != nil {
+			return nil, llmError(err)
+		}
+		result.Markdown = summary
+		result.Metadata = meta
+		if opts.Ephemeral {
+			result.DocsPath = ""
+		}
+		return result, nil
+	}
+
+	logger.Println("\nGenerating documentation...")
+	if err := docGen.LoadOrGenerateDocs(ctx, selectedFilesMap, meta); err != nil {
+		return nil, llmError(err)
+	}
+
+	// Perform cleanup pass to remove duplicates
+	if cfg.Dedup {
+		if err := docGen.CleanupDuplicates(ctx); err != nil {
+			return nil, llmError(err)
+		}
+	} else if err := docGen.SkipCleanup(); err != nil {
+		return nil, fsError(err)
+	}
+	if opts.PostProcess != "" {
+		if err := docGen.PostProcess(ctx, opts.PostProcess); err != nil {
+			return nil, fsError(err)
+		}
+	}
+	if cfg.Tags {
+		if err := docGen.ExtractTags(ctx); err != nil {
+			return nil, fsError(err)
+		}
+	}
+	if opts.Manifest {
+		if result.Manifest, err = docGen.GenerateManifest(ctx, selectedFilesMap); err != nil {
+			return nil, llmError(err)
+		}
+	}
+	if err := docGen.RecordLength(); err != nil {
+		return nil, fsError(err)
+	}
+	if cfg.CheckLinks || cfg.StrictLinks {
+		linkClient := httpClient
+		if cfg.SkipExternalLinks {
+			linkClient = nil
+		}
+		logger.Println("\nChecking links...")
+		if result.BrokenLinks, err = docGen.CheckLinks(ctx, linkClient); err != nil {
+			return nil, fsError(err)
+		}
+		if cfg.StrictLinks && len(result.BrokenLinks) > 0 {
+			return nil, linksError(fmt.Errorf("%s has %d broken links", docs.FullDocFileName, len(result.BrokenLinks)))
+		}
+	}
+	if cfg.CiteSource {
+		logger.Println("\nChecking cited source excerpts...")
+		if result.Citations, err = docGen.CheckCitations(); err != nil {
+			return nil, fsError(err)
+		}
+	}
+
+	result.Metadata = docGen.Meta
+	if err := readMarkdown(result); err != nil {
+		return nil, err
+	}
+	if opts.Ephemeral {
+		result.DocsPath = ""
+	}
+	return result, nil
+}
+
+// compareModels generates docGen's sections with each model, through
+// clients that differ from the main one only by model
+func compareModels(ctx context.Context, docGen *docs.Generator, cfg *Config, models []string, httpClient *http.Client, files map[string]*git.RepoFile) ([]string, error) {
+	logger.Printf("\nComparing %s and %s. This output is for evaluating models: it skips the cleanup pass and isn't cached.\n", models[0], models[1])
+
+	clients := make([]docs.LLMClient, len(models))
+	for i, model := range models {
+		client, err := llm.NewClient(cfg.Backend(), []string{model}, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		client.SoftTokenCap = cfg.SoftTokenCap
+		client.HardTokenCap = cfg.HardTokenCap
+		clients[i] = client
+
+		// Prompts must fit the smaller of the two windows
+		if cfg.ContextWindow == 0 {
+			docGen.ContextWindow = min(docGen.ContextWindow, config.ContextWindowFor(model))
+		}
+	}
+	return docGen.Compare(ctx, files, clients, models)
+}
+
+// diffSelection returns the files in selected but not previous, and those
+// in previous but not selected, each sorted
+func diffSelection(previous, selected []string) ([]string, []string) {
+	var added, removed []string
+	for _, path := range selected {
+		if !slices.Contains(previous, path) {
+			added = append(added, path)
+		}
+	}
+	for _, path := range previous {
+		if !slices.Contains(selected, path) {
+			removed = append(removed, path)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed
+}
+
+// reportSelectionChanges prints how a refreshed selection differs from the
+// cached one
+func reportSelectionChanges(added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		logger.Println("The new selection matches the cached one")
+		return
+	}
+	logger.Printf("The new selection adds %d and removes %d files:\n", len(added), len(removed))
+	for _, path := range added {
+		logger.Printf("  + %s\n", path)
+	}
+	for _, path := range removed {
+		logger.Printf("  - %s\n", path)
+	}
+}
+
+// changelogCommits gathers the commit messages for the changelog section.
+// A shallow clone has no history to summarise, so the section is dropped
+// with a warning rather than failing the run.
+func changelogCommits(repo *git.Repository, history int, sections []string) ([]string, []string) {
+	skip := func(reason string) ([]string, []string) {
+		logger.Warnf("skipping the changelog section: %s\n", reason)
+		return slices.DeleteFunc(slices.Clone(sections), func(s string) bool { return s == docs.ChangelogFileName }), nil
+	}
+
+	if history < 2 {
+		return skip("only a shallow clone is available (set --history to fetch recent commits)")
+	}
+	commits, err := repo.RecentCommits(history)
+	if err != nil {
+		return skip(err.Error())
+	}
+	if len(commits) < 2 {
+		return skip("the existing clone is shallow (rerun with --force-clone to fetch history)")
+	}
+	logger.Printf("Summarising %d recent commits for the changelog\n", len(commits))
+	return sections, commits
+}
+
+// authorFiles is how many of the top selected files get ownership hints,
+// and authorsPerFile how many authors each
+const (
+	authorFiles    = 10
+	authorsPerFile = 3
+)
+
+// fileAuthors finds the recent authors of the top selected files for the
+// overview. Without history to read it returns nothing, silently.
+func fileAuthors(repo *git.Repository, cfg *Config, selected []string) map[string][]string {
+	if cfg.History < 2 {
+		return nil
+	}
+	selected = selected[:min(len(selected), authorFiles)]
+	found, err := repo.FileAuthors(selected, cfg.History, authorsPerFile)
+	if err != nil {
+		logger.Verbosef("Skipping ownership hints: %v\n", err)
+		return nil
+	}
+
+	authors := make(map[string][]string, len(found))
+	for path, list := range found {
+		for _, a := range list {
+			label := a.Name
+			if !cfg.NoEmails && a.Email != "" {
+				label += " <" + a.Email + ">"
+			}
+			authors[path] = append(authors[path], label)
+		}
+	}
+	return authors
+}
+
+// CheckResult reports whether cached docs match the repository
+type CheckResult struct {
+	CommitHash string    // the repository's current commit
+	DocsPath   string    // where docs are expected
+	Metadata   *Metadata // nil if no docs were found
+	Current    bool      // docs exist and were generated from CommitHash
+}
+
+// Check clones or updates the repository and compares its commit with the
+// cached docs, without calling the model. Like Generate, it sets
+// process-wide state and must not run alongside another call.
+func Check(ctx context.Context, opts Options) (*CheckResult, error) {
+	cfg, err := resolveConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := httpclient.New(cfg.Proxy)
+	if err != nil {
+		return nil, configError(err)
+	}
+	git.UseHTTPClient(httpClient)
+
+	repo, repoPath, commitHash, err := checkout(ctx, opts, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{
+		CommitHash: commitHash,
+		DocsPath:   resolveDocsPath(cfg, repo, repoPath, commitHash),
+	}
+	if meta, err := docs.LoadMetadata(result.DocsPath); err == nil {
+		result.Metadata = meta
+		result.Current = meta.CommitHash == commitHash
+	}
+	return result, nil
+}
+
+// resolveConfig loads the configuration if none was given and validates it
+func resolveConfig(opts Options) (*Config, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = config.New(); err != nil {
+			return nil, configError(err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, configError(err)
+	}
+	return cfg, nil
+}
+
+// docSettings are the section and language settings, resolved and checked
+type docSettings struct {
+	sections      []string
+	fullSections  []string
+	sectionTokens map[string]int
+	language      string
+}
+
+// resolveDocSettings fails on unknown sections or languages
+func resolveDocSettings(cfg *Config) (docSettings, error) {
+	var settings docSettings
+	var err error
+	if settings.sections, err = docs.ResolveSections(cfg.Sections); err != nil {
+		return settings, err
+	}
+	if settings.fullSections, err = docs.ResolveFullSections(cfg.FullSections, settings.sections); err != nil {
+		return settings, err
+	}
+	if settings.sectionTokens, err = docs.ResolveSectionTokens(cfg.SectionTokens); err != nil {
+		return settings, err
+	}
+	if settings.language, err = docs.NormalizeLanguage(cfg.Language); err != nil {
+		return settings, err
+	}
+	return settings, git.ValidateLanguages(cfg.Languages)
+}
+
+// applyRepoConfig merges the documented repository's own .repocontext.yaml
+// under cfg, so the project's preferences apply wherever the user hasn't set
+// their own. It returns a copy, leaving the caller's Config alone. A file
+// that is malformed or sets invalid values is ignored with a warning.
+func applyRepoConfig(cfg *Config, settings docSettings, repo *git.Repository, repoPath string) (*Config, docSettings) {
+	repoCfg, ignored, err := config.LoadRepoConfig(repoPath)
+	if err != nil {
+		logger.Warnf("ignoring the repository's config: %v\n", err)
+		return cfg, settings
+	}
+	if repoCfg == nil {
+		return cfg, settings
+	}
+	for _, key := range ignored {
+		logger.Warnf("ignoring %q in the repository's %s: it can only be set by your own config, environment or flags\n", key, config.ProjectConfigFile)
+	}
+
+	merged := *cfg
+	applied := merged.ApplyRepo(repoCfg)
+	if len(applied) == 0 {
+		return cfg, settings
+	}
+	mergedSettings, err := resolveDocSettings(&merged)
+	if err != nil {
+		logger.Warnf("ignoring the repository's %s: %v\n", config.ProjectConfigFile, err)
+		return cfg, settings
+	}
+	logger.Printf("Using %s from the repository's %s\n", strings.Join(applied, ", "), config.ProjectConfigFile)
+
+	// The checkout was configured before the file could be read
+	repo.Include = merged.Include
+	repo.Exclude = merged.Exclude
+	repo.Languages = merged.Languages
+	repo.IncludeTests = merged.IncludeTests
+	repo.ForceText = merged.ForceText
+	repo.Strip = merged.StripComments
+	git.SetDocGlobs(merged.DocGlobs)
+	return &merged, mergedSettings
+}
+
+// checkout parses the repository argument, clones or updates it, and
+// returns the repository with its checkout path and current commit.
+func checkout(ctx context.Context, opts Options, cfg *Config) (*git.Repository, string, string, error) {
+	logger.Printf("Parsing repository path: %s\n", opts.Repo)
+	repo, err := git.ParseRepoPath(opts.Repo)
+	if err != nil {
+		return nil, "", "", configError(err)
+	}
+	if repo.IsArchive() && (opts.Branch != "" || opts.Commit != "") {
+		return nil, "", "", configError(errors.New("a branch or commit cannot be combined with an archive URL"))
+	}
+	if opts.Branch != "" {
+		if repo.Tag != "" || repo.Commit != "" {
+			return nil, "", "", configError(errors.New("a branch cannot be combined with @tag or @commit"))
+		}
+		repo.Branch = opts.Branch
+	}
+	if opts.Commit != "" {
+		repo.Tag, repo.Commit = "", ""
+		if err := repo.SetCommit(opts.Commit); err != nil {
+			return nil, "", "", configError(err)
+		}
+	}
+	if opts.Subpath != "" {
+		if err := repo.SetSubpath(opts.Subpath); err != nil {
+			return nil, "", "", configError(err)
+		}
+	}
+	repo.BaseDir = cfg.RepoDir
+	repo.Include = cfg.Include
+	repo.Exclude = cfg.Exclude
+	repo.Languages = cfg.Languages
+	repo.IncludeTests = cfg.IncludeTests
+	repo.EntropyThreshold = cfg.BinaryEntropy
+	repo.TextRatio = cfg.BinaryTextRatio
+	repo.ForceText = cfg.ForceText
+	git.SetDocGlobs(cfg.DocGlobs)
+	repo.Strip = cfg.StripComments
+	repo.Strict = cfg.Strict
+	repo.TruncateSize = int64(cfg.TruncateSize)
+	repo.ForceClone = opts.ForceClone
+	repo.MaxRepoSize = int64(cfg.MaxRepoSize) << 20
+	repo.History = cfg.History
+	repo.Proxy = cfg.Proxy
+
+	if repo.IsArchive() {
+		logger.Printf("Fetching archive %s...\n", repo.ArchiveURL)
+	} else {
+		logger.Printf("Cloning/updating repository %s/%s...\n", repo.User, repo.Repo)
+	}
+	repoPath, err := repo.Clone(ctx)
+	if err != nil {
+		return nil, "", "", gitError(err)
+	}
+
+	logger.Printf("Repository available at: %s\n", repoPath)
+	if err := repo.ValidateSubpath(); err != nil {
+		return nil, "", "", configError(err)
+	}
+
+	commitHash, err := repo.GetCurrentCommitHash()
+	if err != nil {
+		return nil, "", "", gitError(err)
+	}
+	logger.Printf("Current commit: %s\n", commitHash)
+
+	return repo, repoPath, commitHash, nil
+}
+
+// resolveDocsPath returns where docs for this checkout live: under the
+// configured docs dir if set, otherwise next to the clone. Docs generated
+// with different settings, and docs for a subdirectory, are kept apart.
+func resolveDocsPath(cfg *Config, repo *git.Repository, repoPath, commitHash string) string {
+	docsPath := docs.DocsDir(repoPath)
+	if cfg.DocsDir != "" {
+		docsPath = filepath.Join(cfg.DocsDir, repo.User, repo.Repo, commitHash)
+	}
+	return filepath.Join(docsPath, cacheNamespace(cfg), repo.Subpath)
+}
+
+// namespaceLength is how many hex digits of the settings hash name a cache
+const namespaceLength = 8
+
+// cacheNamespace is a short hash of the settings that shape the generated
+// docs: models, size limit, sections and extra instructions, and whether
+// sections are written from summaries. Runs that differ in any of them keep
+// separate caches for the same commit.
+func cacheNamespace(cfg *Config) string {
+	// Resolved names, so listing the default sections explicitly shares the
+	// default cache; invalid names are rejected before docs are written
+	sections, err := docs.ResolveSections(cfg.Sections)
+	if err != nil {
+		sections = cfg.Sections
+	}
+
+	// --full-sections is left out: a cached full.md is reassembled instead
+	// English is left out so existing caches keep their namespace, as are
+	// ownership hints when there's no history to take them from
+	language, _ := docs.NormalizeLanguage(cfg.Language)
+	authors := cfg.Authors && cfg.History >= 2
+	key, _ := json.Marshal(struct {
+		Models       []string `json:"models"`
+		MaxSize      int      `json:"max_size"`
+		Sections     []string `json:"sections"`
+		Instructions string   `json:"instructions"`
+		Language     string   `json:"language,omitempty"`
+		Strip        bool     `json:"strip_comments,omitempty"`
+		Authors      bool     `json:"authors,omitempty"`
+		NoEmails     bool     `json:"no_emails,omitempty"`
+		TruncateSize int      `json:"truncate_size,omitempty"`
+		CiteSource   bool     `json:"cite_source,omitempty"`
+		Incremental  bool     `json:"incremental,omitempty"`
+	}{cfg.ModelChain(), cfg.MaxContextSize, sections, cfg.ExtraInstructions, language, cfg.StripComments, authors, authors && cfg.NoEmails, cfg.TruncateSize, cfg.CiteSource, cfg.Incremental})
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:namespaceLength]
+}
+
+// loadManifest fills in the cached manifest.json when the Manifest option
+// asks for one, reporting false if there's none to reuse, so the cached
+// docs alone don't satisfy the run
+func loadManifest(opts Options, result *Result) bool {
+	if !opts.Manifest {
+		return true
+	}
+	manifest, err := docs.LoadManifest(result.DocsPath)
+	if err != nil {
+		return false
+	}
+	result.Manifest = manifest
+	return true
+}
+
+// readMarkdown loads the combined documentation and its sections into the
+// result
+func readMarkdown(result *Result) error {
+	fullDoc, err := os.ReadFile(filepath.Join(result.DocsPath, docs.FullDocFileName))
+	if err != nil {
+		return fsError(err)
+	}
+	result.Markdown = string(fullDoc)
+	if result.Sections, err = docs.LoadSections(result.DocsPath); err != nil {
+		return fsError(err)
+	}
+	return nil
+}
+
+// totalFileSize adds up the sizes of files
+func totalFileSize(files map[string]*git.RepoFile) int64 {
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	return total
+}
+
+// countCopies totals the duplicates found by DedupeIdentical
+func countCopies(identical map[string][]string) int {
+	n := 0
+	for _, copies := range identical {
+		n += len(copies)
+	}
+	return n
+}
+
+// formatLineCounts lists per-language line counts, largest first
+func formatLineCounts(byLanguage map[string]int) string {
+	languages := make([]string, 0, len(byLanguage))
+	for lang := range byLanguage {
+		languages = append(languages, lang)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if byLanguage[languages[i]] != byLanguage[languages[j]] {
+			return byLanguage[languages[i]] > byLanguage[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
+
+	parts := make([]string, len(languages))
+	for i, lang := range languages {
+		parts[i] = fmt.Sprintf("%s %d", lang, byLanguage[lang])
+	}
+	return strings.Join(parts, ", ")
+}